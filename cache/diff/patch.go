@@ -0,0 +1,126 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Applies a partial update to a copy of to, returning the copy
+//
+// Fields named in clear (Fields* values such as types.ICON_FieldsChannel) are reset to
+// their zero value first. Clear values that don't name a field of T directly are looked
+// up as a field followed by a nested field, for example types.STATUS_TEXT_FieldsUser
+// clears Status.Text. Unknown clear values are ignored.
+//
+// Fields of patch whose JSON key is listed in fields are then applied even if they are
+// zero values, so nicknames can be emptied and booleans set to false. If fields is nil
+// (such as when the keys sent are not known), all non-zero fields of patch are applied
+// like PartialUpdate does.
+//
+// Unlike PartialUpdate, to is not modified. Nested structs are copied before being
+// cleared, other fields are shared between to and the copy.
+func Patch[T any, F ~string](to *T, patch *T, fields []string, clear []F) *T {
+	res := new(T)
+
+	if to != nil {
+		*res = *to
+	}
+
+	v := reflect.ValueOf(res).Elem()
+
+	for _, c := range clear {
+		clearField(v, string(c))
+	}
+
+	if patch == nil {
+		return res
+	}
+
+	p := reflect.ValueOf(patch).Elem()
+
+	if fields == nil {
+		for i := 0; i < p.NumField(); i++ {
+			if !p.Field(i).IsZero() {
+				v.Field(i).Set(p.Field(i))
+			}
+		}
+
+		return res
+	}
+
+	for _, key := range fields {
+		if i := fieldByJSONKey(v.Type(), key); i >= 0 {
+			v.Field(i).Set(p.Field(i))
+		}
+	}
+
+	return res
+}
+
+// Resets the named field of the struct v to its zero value
+//
+// Returns false if no such field exists
+func clearField(v reflect.Value, name string) bool {
+	if f := v.FieldByName(name); f.IsValid() && f.CanSet() {
+		f.Set(reflect.Zero(f.Type()))
+		return true
+	}
+
+	// Look for a nested field, such as StatusText -> Status.Text
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if !sf.IsExported() || !strings.HasPrefix(name, sf.Name) || len(name) == len(sf.Name) {
+			continue
+		}
+
+		f := v.Field(i)
+		rest := name[len(sf.Name):]
+
+		switch {
+		case f.Kind() == reflect.Struct:
+			if clearField(f, rest) {
+				return true
+			}
+		case f.Kind() == reflect.Pointer && f.Type().Elem().Kind() == reflect.Struct:
+			if f.IsNil() {
+				continue
+			}
+
+			// Clear a copy, the nested struct may be shared with the cached entity
+			nested := reflect.New(f.Type().Elem())
+			nested.Elem().Set(f.Elem())
+
+			if clearField(nested.Elem(), rest) {
+				f.Set(nested)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns the index of the field of t with the given JSON key, or -1
+func fieldByJSONKey(t reflect.Type, key string) int {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		if name == key {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,100 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+func TestPatchChannel(t *testing.T) {
+	c := &types.Channel{Id: "c", Name: "general", Description: "chat", Icon: &types.File{Id: "icon"}, NSFW: true}
+
+	res := Patch(c, &types.Channel{Name: "chat"}, []string{"name", "nsfw"}, []types.FieldsChannel{types.DESCRIPTION_FieldsChannel, types.ICON_FieldsChannel})
+
+	if res.Name != "chat" || res.Description != "" || res.Icon != nil || res.NSFW || res.Id != "c" {
+		t.Fatalf("unexpected channel %+v", res)
+	}
+
+	if c.Name != "general" || c.Description != "chat" || c.Icon == nil || !c.NSFW {
+		t.Fatal("original channel was modified")
+	}
+}
+
+func TestPatchServer(t *testing.T) {
+	s := &types.Server{Id: "s", Name: "Revolt", Banner: &types.File{Id: "banner"}, Categories: []*types.Category{{}}, Discoverable: true}
+
+	res := Patch(s, &types.Server{}, []string{"discoverable"}, []types.FieldsServer{types.BANNER_FieldsServer, types.CATEGORIES_FieldsServer})
+
+	if res.Banner != nil || res.Categories != nil || res.Discoverable || res.Name != "Revolt" {
+		t.Fatalf("unexpected server %+v", res)
+	}
+}
+
+func TestPatchMember(t *testing.T) {
+	m := &types.Member{Id: &types.MemberId{Server: "s", User: "u"}, Nickname: "lexi", Roles: []string{"r"}}
+
+	res := Patch(m, &types.Member{}, []string{}, []types.FieldsMember{types.NICKNAME_FieldsMember, types.ROLES_FieldsMember})
+
+	if res.Nickname != "" || res.Roles != nil || res.Id == nil {
+		t.Fatalf("unexpected member %+v", res)
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	u := &types.User{
+		Id:          "u",
+		DisplayName: "Lexi",
+		Online:      true,
+		Status:      &types.UserStatus{Text: "vibing", Presence: "Online"},
+		Profile:     &types.UserProfile{Content: "hi", Background: &types.File{Id: "bg"}},
+	}
+
+	res := Patch(u, &types.User{}, []string{"online"}, []types.FieldsUser{
+		types.STATUS_TEXT_FieldsUser,
+		types.PROFILE_BACKGROUND_FieldsUser,
+		types.DISPLAY_NAME_FieldsUser,
+	})
+
+	if res.Status.Text != "" || res.Status.Presence != "Online" {
+		t.Fatalf("unexpected status %+v", res.Status)
+	}
+
+	if res.Profile.Background != nil || res.Profile.Content != "hi" {
+		t.Fatalf("unexpected profile %+v", res.Profile)
+	}
+
+	if res.DisplayName != "" || res.Online {
+		t.Fatalf("unexpected user %+v", res)
+	}
+
+	if u.Status.Text != "vibing" || u.Profile.Background == nil {
+		t.Fatal("nested structs of original user were modified")
+	}
+
+	// Clearing a field of a nested struct that is not set is a no-op
+	res = Patch(&types.User{Id: "u"}, nil, nil, []types.FieldsUser{types.STATUS_PRESENCE_FieldsUser, "Unknown"})
+
+	if res.Status != nil || res.Id != "u" {
+		t.Fatalf("unexpected user %+v", res)
+	}
+}
+
+func TestPatchRole(t *testing.T) {
+	r := &types.Role{Name: "Moderator", Colour: "#e74c3c", Hoist: true, Rank: 1}
+
+	res := Patch(r, &types.Role{Rank: 0}, []string{"hoist", "rank"}, []types.FieldsRole{types.COLOUR_FieldsRole})
+
+	if res.Colour != "" || res.Hoist || res.Rank != 0 || res.Name != "Moderator" {
+		t.Fatalf("unexpected role %+v", res)
+	}
+}
+
+func TestPatchWebhook(t *testing.T) {
+	w := &types.Webhook{Id: "w", Name: "GitHub", Avatar: &types.File{Id: "avatar"}}
+
+	res := Patch(w, &types.Webhook{Name: "GitHub Releases"}, nil, []types.FieldsWebhook{types.AVATAR_FieldsWebhook})
+
+	if res.Avatar != nil || res.Name != "GitHub Releases" || res.Id != "w" {
+		t.Fatalf("unexpected webhook %+v", res)
+	}
+}
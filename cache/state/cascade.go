@@ -0,0 +1,263 @@
+package state
+
+import (
+	"errors"
+
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// Helpers updating entities that reference each other
+//
+// Cached entities are never modified in place, entities are copied and set again.
+// Entities that are not cached are left alone.
+
+// SetRole adds or replaces a role of a cached server
+func (s *State) SetRole(serverId, roleId string, role *types.Role) error {
+	se, err := s.GetServer(serverId)
+
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	newServ := *se
+	newServ.Roles = make(map[string]*types.Role, len(se.Roles)+1)
+
+	for k, v := range se.Roles {
+		newServ.Roles[k] = v
+	}
+
+	newServ.Roles[roleId] = role
+
+	return s.AddServer(&newServ)
+}
+
+// RemoveRole removes a role from a cached server and from all of its cached members
+//
+// Members are only updated if the member store implements store.PrefixScanner
+func (s *State) RemoveRole(serverId, roleId string) error {
+	se, err := s.GetServer(serverId)
+
+	if err == nil {
+		if _, ok := se.Roles[roleId]; ok {
+			newServ := *se
+			newServ.Roles = make(map[string]*types.Role, len(se.Roles))
+
+			for k, v := range se.Roles {
+				if k != roleId {
+					newServ.Roles[k] = v
+				}
+			}
+
+			if err := s.AddServer(&newServ); err != nil {
+				return err
+			}
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	members, err := s.GetServerMembers(serverId)
+
+	if err != nil {
+		return ignoreUnsupported(err)
+	}
+
+	for _, m := range members {
+		roles := without(m.Roles, roleId)
+
+		if len(roles) == len(m.Roles) {
+			continue
+		}
+
+		newMember := *m
+		newMember.Roles = roles
+
+		if err := s.AddMember(&newMember); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveChannel deletes a channel and removes it from its cached server
+func (s *State) RemoveChannel(id string) error {
+	c, err := s.GetChannel(id)
+
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	if c.Server != "" {
+		se, err := s.GetServer(c.Server)
+
+		if err == nil {
+			newServ := *se
+			newServ.Channels = without(se.Channels, id)
+
+			if err := s.AddServer(&newServ); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+
+	return ignoreNotFound(s.DeleteChannel(id))
+}
+
+// AddRecipient adds a user to the recipients of a cached group
+func (s *State) AddRecipient(channelId, userId string) error {
+	c, err := s.GetChannel(channelId)
+
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	for _, r := range c.Recipients {
+		if r == userId {
+			return nil
+		}
+	}
+
+	newChan := *c
+	newChan.Recipients = append(append(make([]string, 0, len(c.Recipients)+1), c.Recipients...), userId)
+
+	return s.AddChannel(&newChan)
+}
+
+// RemoveRecipient removes a user from the recipients of a cached group
+func (s *State) RemoveRecipient(channelId, userId string) error {
+	c, err := s.GetChannel(channelId)
+
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	newChan := *c
+	newChan.Recipients = without(c.Recipients, userId)
+
+	return s.AddChannel(&newChan)
+}
+
+// PurgeServer deletes a server along with its cached channels and members
+//
+// Members are only deleted if the member store implements store.PrefixScanner
+func (s *State) PurgeServer(id string) error {
+	se, err := s.GetServer(id)
+
+	if err == nil {
+		for _, channel := range se.Channels {
+			if err := ignoreNotFound(s.DeleteChannel(channel)); err != nil {
+				return err
+			}
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	members, err := s.GetServerMembers(id)
+
+	if err != nil && !errors.Is(err, store.ErrUnsupported) {
+		return err
+	}
+
+	for _, m := range members {
+		if err := ignoreNotFound(s.DeleteMember(id, m.Id.User)); err != nil {
+			return err
+		}
+	}
+
+	return ignoreNotFound(s.DeleteServer(id))
+}
+
+// PurgeUser deletes a user along with their cached members and messages
+//
+// Members and messages are only deleted if their stores implement store.PrefixScanner.
+// If the message store implements store.Evicter, edit and delete history of the users
+// messages is removed as well.
+func (s *State) PurgeUser(id string) error {
+	if err := ignoreNotFound(s.DeleteUser(id)); err != nil {
+		return err
+	}
+
+	if scanner, ok := s.Members.(store.PrefixScanner[types.Member]); ok {
+		var servers []string
+		err := scanner.ScanPrefix("", func(_ string, m *types.Member) bool {
+			if m.Id != nil && m.Id.User == id {
+				servers = append(servers, m.Id.Server)
+			}
+
+			return true
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, server := range servers {
+			if err := ignoreNotFound(s.DeleteMember(server, id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if evicter, ok := s.Messages.(store.Evicter[types.Message]); ok {
+		return evicter.EvictWhere(func(_ string, m *types.Message) bool {
+			return m.Author == id
+		})
+	}
+
+	if scanner, ok := s.Messages.(store.PrefixScanner[types.Message]); ok {
+		var msgs []string
+		err := scanner.ScanPrefix("", func(msgId string, m *types.Message) bool {
+			if m.Author == id {
+				msgs = append(msgs, msgId)
+			}
+
+			return true
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			if err := ignoreNotFound(s.DeleteMessage(msg)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func ignoreNotFound(err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func ignoreUnsupported(err error) error {
+	if errors.Is(err, store.ErrUnsupported) {
+		return nil
+	}
+
+	return err
+}
+
+// Returns a copy of ids without id
+func without(ids []string, id string) []string {
+	res := make([]string, 0, len(ids))
+
+	for _, v := range ids {
+		if v != id {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
@@ -21,6 +21,15 @@ type State struct {
 
 	// Emojis
 	Emojis store.Store[types.Emoji]
+
+	// Messages, optional as messages are only cached if this is set
+	//
+	// messagestore.MessageStore bounds the number of cached messages and keeps edit and
+	// delete history (see GetMessageRevision and GetDeletedMessage)
+	Messages store.Store[types.Message]
+
+	// Webhooks, optional as webhooks are only cached if this is set
+	Webhooks store.Store[types.Webhook]
 }
 
 // Users
@@ -91,6 +100,25 @@ func (s *State) DeleteMember(serverId, userId string) error {
 	return s.Members.Delete(serverId + "/" + userId)
 }
 
+// GetServerMembers returns all cached members of a server
+//
+// The members store must implement store.PrefixScanner
+func (s *State) GetServerMembers(serverId string) ([]*types.Member, error) {
+	scanner, ok := s.Members.(store.PrefixScanner[types.Member])
+
+	if !ok {
+		return nil, store.ErrUnsupported
+	}
+
+	var members []*types.Member
+	err := scanner.ScanPrefix(serverId+"/", func(id string, m *types.Member) bool {
+		members = append(members, m)
+		return true
+	})
+
+	return members, err
+}
+
 // Emojis
 
 // GetEmoji returns an emoji from the state
@@ -107,3 +135,88 @@ func (s *State) AddEmoji(e *types.Emoji) error {
 func (s *State) DeleteEmoji(id string) error {
 	return s.Emojis.Delete(id)
 }
+
+// Messages
+
+// GetMessage returns a message from the state
+func (s *State) GetMessage(id string) (*types.Message, error) {
+	if s.Messages == nil {
+		return nil, store.ErrUnsupported
+	}
+
+	return s.Messages.Get(id)
+}
+
+// AddMessage adds a message to the state or updates it
+func (s *State) AddMessage(m *types.Message) error {
+	if s.Messages == nil {
+		return store.ErrUnsupported
+	}
+
+	return s.Messages.Set(m.Id, m)
+}
+
+// DeleteMessage deletes a message from the state
+func (s *State) DeleteMessage(id string) error {
+	if s.Messages == nil {
+		return store.ErrUnsupported
+	}
+
+	return s.Messages.Delete(id)
+}
+
+// GetMessageRevision returns a message before its last edit along with its current
+// version, before is nil if the message was not edited since it was cached
+//
+// The message store must implement store.Versioned
+func (s *State) GetMessageRevision(id string) (before *types.Message, after *types.Message, err error) {
+	versioned, ok := s.Messages.(store.Versioned[types.Message])
+
+	if !ok {
+		return nil, nil, store.ErrUnsupported
+	}
+
+	return versioned.GetRevision(id)
+}
+
+// GetDeletedMessage returns the last version of a deleted message
+//
+// The message store must implement store.Versioned
+func (s *State) GetDeletedMessage(id string) (*types.Message, error) {
+	versioned, ok := s.Messages.(store.Versioned[types.Message])
+
+	if !ok {
+		return nil, store.ErrUnsupported
+	}
+
+	return versioned.GetDeleted(id)
+}
+
+// Webhooks
+
+// GetWebhook returns a webhook from the state
+func (s *State) GetWebhook(id string) (*types.Webhook, error) {
+	if s.Webhooks == nil {
+		return nil, store.ErrUnsupported
+	}
+
+	return s.Webhooks.Get(id)
+}
+
+// AddWebhook adds a webhook to the state or updates it
+func (s *State) AddWebhook(w *types.Webhook) error {
+	if s.Webhooks == nil {
+		return store.ErrUnsupported
+	}
+
+	return s.Webhooks.Set(w.Id, w)
+}
+
+// DeleteWebhook deletes a webhook from the state
+func (s *State) DeleteWebhook(id string) error {
+	if s.Webhooks == nil {
+		return store.ErrUnsupported
+	}
+
+	return s.Webhooks.Delete(id)
+}
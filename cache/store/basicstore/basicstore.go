@@ -2,6 +2,7 @@ package basicstore
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/infinitybotlist/grevolt/cache/store"
@@ -101,6 +102,26 @@ func (s *BasicStore[T]) Delete(id string) error {
 	return nil
 }
 
+// Calls fn for every entity whose ID starts with prefix, stopping if fn returns false
+//
+// This scans the whole store
+func (s *BasicStore[T]) ScanPrefix(prefix string, fn func(id string, entity *T) bool) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	for id, entity := range s.dataStore {
+		if strings.HasPrefix(id, prefix) && !fn(id, entity) {
+			break
+		}
+	}
+
+	return nil
+}
+
 // Returns the length of the store
 func (s *BasicStore[T]) Length() int {
 	return len(s.dataStore)
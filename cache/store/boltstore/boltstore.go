@@ -0,0 +1,295 @@
+// Package boltstore provides a store persisted to an embedded bbolt database so the
+// state survives restarts
+//
+// Entities are served from memory and written to disk in batches by Flush, each flush
+// is a single bbolt transaction so a crash leaves the database at the last complete
+// flush. Persister flushes all of its stores in one transaction, so stores are never
+// out of sync with each other on disk. Load reads the database back into memory (a
+// warm start), which should be done before the gateway connects.
+package boltstore
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"go.etcd.io/bbolt"
+)
+
+// A store keeping entities in memory and in a bucket of a bbolt database
+type BoltStore[T any] struct {
+	sync.RWMutex
+
+	// The database to persist to, may be shared by stores using different buckets
+	DB *bbolt.DB
+
+	// Bucket entities are stored in, every entity type must use its own bucket
+	Bucket string
+
+	// Whether or not to track in this state
+	Disabled bool
+
+	dataStore map[string]*T
+
+	// Entities changed since the last flush, nil if deleted
+	dirty map[string]*T
+}
+
+// New returns a new store persisting to the given bucket of db
+//
+// The store starts out empty, call Load to read entities from a previous run
+func New[T any](db *bbolt.DB, bucket string) *BoltStore[T] {
+	return &BoltStore[T]{
+		DB:        db,
+		Bucket:    bucket,
+		dataStore: make(map[string]*T),
+		dirty:     make(map[string]*T),
+	}
+}
+
+// Must be called with the write lock held
+func (s *BoltStore[T]) init() {
+	if s.dataStore == nil {
+		s.dataStore = make(map[string]*T)
+	}
+
+	if s.dirty == nil {
+		s.dirty = make(map[string]*T)
+	}
+}
+
+// Is the state usable
+func (s *BoltStore[T]) Usable() bool {
+	return !s.Disabled
+}
+
+// Get an entity from the state
+func (s *BoltStore[T]) Get(id string) (*T, error) {
+	if s.Disabled {
+		return nil, store.ErrDisabled
+	}
+
+	if id == "" {
+		return nil, store.ErrIdInvalid
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	entity, ok := s.dataStore[id]
+
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return entity, nil
+}
+
+// Set an entity in the state, it is written to disk on the next flush
+func (s *BoltStore[T]) Set(id string, entity *T) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	if id == "" {
+		return store.ErrIdInvalid
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.init()
+	s.dataStore[id] = entity
+	s.dirty[id] = entity
+
+	return nil
+}
+
+// Delete an entity from the state, it is removed from disk on the next flush
+func (s *BoltStore[T]) Delete(id string) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	if id == "" {
+		return store.ErrIdInvalid
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.init()
+	delete(s.dataStore, id)
+	s.dirty[id] = nil
+
+	return nil
+}
+
+// Calls fn for every entity whose ID starts with prefix, stopping if fn returns false
+func (s *BoltStore[T]) ScanPrefix(prefix string, fn func(id string, entity *T) bool) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	s.RLock()
+
+	var ids []string
+	var entities []*T
+	for id, entity := range s.dataStore {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+			entities = append(entities, entity)
+		}
+	}
+
+	s.RUnlock()
+
+	// fn is called without the lock held so it may modify the store
+	for i, id := range ids {
+		if !fn(id, entities[i]) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Returns the length of the store
+func (s *BoltStore[T]) Length() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.dataStore)
+}
+
+// Returns the number of entities changed since the last flush
+func (s *BoltStore[T]) Pending() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.dirty)
+}
+
+// Load replaces the entities in memory with those on disk
+//
+// Changes not yet flushed are discarded
+func (s *BoltStore[T]) Load() error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	entities := make(map[string]*T)
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(s.Bucket))
+
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var entity T
+			if err := json.Unmarshal(v, &entity); err != nil {
+				return err
+			}
+
+			entities[string(k)] = &entity
+			return nil
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.dataStore = entities
+	s.dirty = make(map[string]*T)
+
+	return nil
+}
+
+// Flush writes all changes since the last flush to disk in a single transaction
+//
+// If the transaction fails, the changes are kept and retried on the next flush
+func (s *BoltStore[T]) Flush() error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	write, restore := s.takeChanges()
+
+	if write == nil {
+		return nil
+	}
+
+	if err := s.DB.Update(write); err != nil {
+		restore()
+		return err
+	}
+
+	return nil
+}
+
+// Takes the changes since the last flush, returning a function writing them in a
+// transaction and a function giving them back to the store if the transaction fails
+//
+// Both are nil if nothing changed
+func (s *BoltStore[T]) takeChanges() (write func(tx *bbolt.Tx) error, restore func()) {
+	s.Lock()
+	s.init()
+	dirty := s.dirty
+	s.dirty = make(map[string]*T)
+	s.Unlock()
+
+	if len(dirty) == 0 {
+		return nil, nil
+	}
+
+	write = func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(s.Bucket))
+
+		if err != nil {
+			return err
+		}
+
+		for id, entity := range dirty {
+			if entity == nil {
+				if err := b.Delete([]byte(id)); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			v, err := json.Marshal(entity)
+
+			if err != nil {
+				return err
+			}
+
+			if err := b.Put([]byte(id), v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	restore = func() {
+		s.Lock()
+		defer s.Unlock()
+
+		// Keep changes made while flushing, they are newer
+		for id, entity := range dirty {
+			if _, ok := s.dirty[id]; !ok {
+				s.dirty[id] = entity
+			}
+		}
+	}
+
+	return write, restore
+}
@@ -0,0 +1,294 @@
+package boltstore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"github.com/infinitybotlist/grevolt/gateway/events"
+	"github.com/infinitybotlist/grevolt/types"
+	"go.etcd.io/bbolt"
+)
+
+// Ensure BoltStore can be used in place of the in-memory stores
+var (
+	_ store.Store[types.User]         = (*BoltStore[types.User])(nil)
+	_ store.PrefixScanner[types.User] = (*BoltStore[types.User])(nil)
+)
+
+func open(t *testing.T, path string, opts Options) *Persister {
+	t.Helper()
+
+	if opts.FlushInterval == 0 {
+		// Only flush when asked to
+		opts.FlushInterval = time.Hour
+	}
+
+	p, err := Open(path, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestWarmStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	p := open(t, path, Options{})
+
+	s := &state.State{}
+	p.Use(s)
+
+	s.AddUser(&types.User{Id: "user", Username: "grevolt"})
+	s.AddServer(&types.Server{Id: "server", Name: "Server"})
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: "server", User: "user"}, Nickname: "nick"})
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: "server", User: "left"}})
+	s.AddWebhook(&types.Webhook{Id: "webhook", Name: "Hook"})
+
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.DeleteMember("server", "left")
+
+	// Close flushes the deletion
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p = open(t, path, Options{WarmStart: true})
+	defer p.Close()
+
+	s = &state.State{}
+	p.Use(s)
+
+	if u, err := s.GetUser("user"); err != nil || u.Username != "grevolt" {
+		t.Fatalf("user not restored: %+v, %v", u, err)
+	}
+
+	if w, err := s.GetWebhook("webhook"); err != nil || w.Name != "Hook" {
+		t.Fatalf("webhook not restored: %+v, %v", w, err)
+	}
+
+	members, err := s.GetServerMembers("server")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 1 || members[0].Nickname != "nick" {
+		t.Fatalf("got members %+v, want only user", members)
+	}
+
+	if _, err := s.GetMember("server", "left"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("deleted member restored: %v", err)
+	}
+}
+
+func TestColdStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	p := open(t, path, Options{})
+	p.Users.Set("user", &types.User{Id: "user"})
+	p.Close()
+
+	p = open(t, path, Options{})
+	defer p.Close()
+
+	if p.Users.Length() != 0 {
+		t.Fatal("entities loaded without WarmStart")
+	}
+
+	if err := p.Users.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Users.Get("user"); err != nil {
+		t.Fatalf("user not loaded: %v", err)
+	}
+}
+
+func TestCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	p := open(t, path, Options{})
+
+	p.Users.Set("flushed", &types.User{Id: "flushed"})
+
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Users.Set("pending", &types.User{Id: "pending"})
+
+	// Close the database without flushing, as if the process crashed
+	if err := p.DB.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed flush keeps its changes for the next attempt
+	if err := p.Flush(); err == nil {
+		t.Fatal("flush to closed database succeeded")
+	}
+
+	if n := p.Users.Pending(); n != 1 {
+		t.Fatalf("got %d pending changes after failed flush, want 1", n)
+	}
+
+	p = open(t, path, Options{WarmStart: true})
+	defer p.Close()
+
+	if _, err := p.Users.Get("flushed"); err != nil {
+		t.Fatalf("flushed user lost: %v", err)
+	}
+
+	if _, err := p.Users.Get("pending"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("unflushed user persisted: %v", err)
+	}
+}
+
+func TestFlushIsAtomic(t *testing.T) {
+	p := open(t, filepath.Join(t.TempDir(), "state.db"), Options{})
+	defer p.Close()
+
+	p.Users.Set("user", &types.User{Id: "user"})
+	p.Channels.Set("channel", &types.Channel{Id: "channel"})
+
+	// Writing channels fails as bbolt requires a bucket name
+	p.Channels.Bucket = ""
+
+	if err := p.Flush(); err == nil {
+		t.Fatal("flush with an invalid bucket succeeded")
+	}
+
+	p.DB.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket([]byte("users")); b != nil && b.Get([]byte("user")) != nil {
+			t.Fatal("users were written by a failed flush")
+		}
+
+		return nil
+	})
+
+	if p.Users.Pending() != 1 || p.Channels.Pending() != 1 {
+		t.Fatal("changes of a failed flush were not kept")
+	}
+
+	p.Channels.Bucket = "channels"
+
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Users.Pending() != 0 || p.Channels.Pending() != 0 {
+		t.Fatal("changes were not flushed")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	p := open(t, filepath.Join(t.TempDir(), "state.db"), Options{})
+	defer p.Close()
+
+	s := &state.State{}
+	p.Use(s)
+
+	// Cached by a previous run, the bot has since been removed from left
+	s.AddServer(&types.Server{Id: "left", Channels: []string{"left-channel"}})
+	s.AddChannel(&types.Channel{Id: "left-channel", Server: "left"})
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: "left", User: "user"}})
+	s.AddServer(&types.Server{Id: "server", Channels: []string{"channel", "deleted"}})
+	s.AddChannel(&types.Channel{Id: "channel", Server: "server"})
+	s.AddChannel(&types.Channel{Id: "deleted", Server: "server"})
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: "server", User: "user"}})
+
+	err := p.Reconcile(&events.Ready{
+		Servers:  []*types.Server{{Id: "server", Channels: []string{"channel", "deleted"}}},
+		Channels: []*types.Channel{{Id: "channel", Server: "server"}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetServer("left"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("server missing from ready was kept")
+	}
+
+	if _, err := s.GetChannel("left-channel"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("channel of removed server was kept")
+	}
+
+	if _, err := s.GetMember("left", "user"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("member of removed server was kept")
+	}
+
+	if _, err := s.GetChannel("deleted"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("channel missing from ready was kept")
+	}
+
+	if se, err := s.GetServer("server"); err != nil || len(se.Channels) != 1 {
+		t.Fatalf("unexpected server after reconciling %+v: %v", se, err)
+	}
+
+	if _, err := s.GetMember("server", "user"); err != nil {
+		t.Fatal("member of remaining server was removed")
+	}
+}
+
+func TestPeriodicFlush(t *testing.T) {
+	p := open(t, filepath.Join(t.TempDir(), "state.db"), Options{FlushInterval: 10 * time.Millisecond})
+	defer p.Close()
+
+	p.Channels.Set("channel", &types.Channel{Id: "channel"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var found bool
+		p.DB.View(func(tx *bbolt.Tx) error {
+			if b := tx.Bucket([]byte("channels")); b != nil {
+				found = b.Get([]byte("channel")) != nil
+			}
+
+			return nil
+		})
+
+		if found {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("channel was not flushed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := p.Channels.Pending(); n != 0 {
+		t.Fatalf("got %d pending changes after flush, want 0", n)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	p := open(t, filepath.Join(t.TempDir(), "state.db"), Options{})
+	defer p.Close()
+
+	if _, err := p.Users.Get("missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := p.Users.Set("", &types.User{}); !errors.Is(err, store.ErrIdInvalid) {
+		t.Fatalf("expected ErrIdInvalid, got %v", err)
+	}
+
+	p.Users.Disabled = true
+
+	if _, err := p.Users.Get("user"); !errors.Is(err, store.ErrDisabled) {
+		t.Fatalf("expected ErrDisabled, got %v", err)
+	}
+
+	p.Users.Disabled = false
+}
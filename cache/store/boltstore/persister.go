@@ -0,0 +1,258 @@
+package boltstore
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/gateway/events"
+	"github.com/infinitybotlist/grevolt/types"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// Default interval between flushes
+const DefaultFlushInterval = 5 * time.Second
+
+// Options for Open
+type Options struct {
+	// Interval between flushes, defaults to DefaultFlushInterval
+	//
+	// Changes made since the last flush are lost if the process crashes
+	FlushInterval time.Duration
+
+	// Whether to load the entities saved by a previous run when opening
+	WarmStart bool
+
+	// Logger for flush errors, defaults to a no-op logger
+	Logger *zap.Logger
+}
+
+// Persists users, servers, channels, members, emojis and webhooks to a bbolt database
+//
+// Messages are not persisted, they are short-lived and bounded by messagestore instead.
+type Persister struct {
+	DB *bbolt.DB
+
+	Users    *BoltStore[types.User]
+	Servers  *BoltStore[types.Server]
+	Channels *BoltStore[types.Channel]
+	Members  *BoltStore[types.Member]
+	Emojis   *BoltStore[types.Emoji]
+	Webhooks *BoltStore[types.Webhook]
+
+	Logger *zap.Logger
+
+	stop chan struct{}
+	done chan struct{}
+
+	closeOnce sync.Once
+}
+
+type flusher interface {
+	Usable() bool
+	Load() error
+	takeChanges() (write func(tx *bbolt.Tx) error, restore func())
+}
+
+// Open opens (or creates) the database at path and starts flushing to it periodically
+//
+// With WarmStart set, entities from the previous run are loaded before Open returns,
+// so they are available before the gateway connects. Entities that changed while the
+// bot was offline are updated by the Ready event, but entities that were deleted stay
+// cached until Reconcile is called with the Ready event.
+func Open(path string, opts Options) (*Persister, error) {
+	// Fail instead of waiting forever if another process has the database open
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	p := &Persister{
+		DB:       db,
+		Users:    New[types.User](db, "users"),
+		Servers:  New[types.Server](db, "servers"),
+		Channels: New[types.Channel](db, "channels"),
+		Members:  New[types.Member](db, "members"),
+		Emojis:   New[types.Emoji](db, "emojis"),
+		Webhooks: New[types.Webhook](db, "webhooks"),
+		Logger:   opts.Logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if opts.WarmStart {
+		for _, s := range p.stores() {
+			if err := s.Load(); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+	}
+
+	go p.flushLoop(opts.FlushInterval)
+
+	return p, nil
+}
+
+func (p *Persister) stores() []flusher {
+	return []flusher{p.Users, p.Servers, p.Channels, p.Members, p.Emojis, p.Webhooks}
+}
+
+// Use makes s use the stores of the persister, messages are left untouched
+//
+// This must be called before the gateway connects, for example right after client.New
+func (p *Persister) Use(s *state.State) {
+	s.Users = p.Users
+	s.Servers = p.Servers
+	s.Channels = p.Channels
+	s.Members = p.Members
+	s.Emojis = p.Emojis
+	s.Webhooks = p.Webhooks
+}
+
+// Flush writes all pending changes to disk in a single transaction
+//
+// If the transaction fails, no changes are written and all of them are retried on the
+// next flush
+func (p *Persister) Flush() error {
+	var writes []func(tx *bbolt.Tx) error
+	var restores []func()
+
+	for _, s := range p.stores() {
+		if !s.Usable() {
+			continue
+		}
+
+		write, restore := s.takeChanges()
+
+		if write == nil {
+			continue
+		}
+
+		writes = append(writes, write)
+		restores = append(restores, restore)
+	}
+
+	if len(writes) == 0 {
+		return nil
+	}
+
+	err := p.DB.Update(func(tx *bbolt.Tx) error {
+		for _, write := range writes {
+			if err := write(tx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		for _, restore := range restores {
+			restore()
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Reconcile removes servers and channels that are no longer part of the Ready event of
+// a new connection, such as those loaded by a warm start that were deleted or left while
+// the bot was offline
+//
+// The members of removed servers are removed as well. Members of remaining servers can't
+// be checked against Ready as it only contains the bot's own members, use
+// FetchAllMembers to refresh them.
+//
+// This is meant to be called from a Ready event handler
+func (p *Persister) Reconcile(ready *events.Ready) error {
+	s := &state.State{}
+	p.Use(s)
+
+	servers := make(map[string]bool, len(ready.Servers))
+	for _, server := range ready.Servers {
+		servers[server.Id] = true
+	}
+
+	channels := make(map[string]bool, len(ready.Channels))
+	for _, channel := range ready.Channels {
+		channels[channel.Id] = true
+	}
+
+	var staleServers, staleChannels []string
+
+	p.Servers.ScanPrefix("", func(id string, _ *types.Server) bool {
+		if !servers[id] {
+			staleServers = append(staleServers, id)
+		}
+
+		return true
+	})
+
+	p.Channels.ScanPrefix("", func(id string, _ *types.Channel) bool {
+		if !channels[id] {
+			staleChannels = append(staleChannels, id)
+		}
+
+		return true
+	})
+
+	for _, id := range staleServers {
+		if err := s.PurgeServer(id); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range staleChannels {
+		if err := s.RemoveChannel(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Persister) flushLoop(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			if err := p.Flush(); err != nil {
+				p.Logger.Error("failed to flush state", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Close stops periodic flushing, flushes pending changes and closes the database
+func (p *Persister) Close() error {
+	var err error
+
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		<-p.done
+
+		err = errors.Join(p.Flush(), p.DB.Close())
+	})
+
+	return err
+}
@@ -0,0 +1,407 @@
+package messagestore
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// Default number of messages kept per channel
+const DefaultPerChannel = 100
+
+// Default number of channels messages are kept for
+const DefaultMaxChannels = 1000
+
+// A bounded store for messages
+//
+// Messages are kept in a ring buffer per channel, once a channel is full its oldest
+// message is evicted. Channels are evicted least recently used first once MaxChannels
+// is reached.
+//
+// The store keeps the previous version of edited messages and the last version of
+// deleted messages until they are evicted, see store.Versioned. store.Evicter removes
+// this history, such as when a user's data is wiped.
+type MessageStore struct {
+	sync.Mutex
+
+	// Maximum number of messages kept per channel, defaults to DefaultPerChannel
+	PerChannel int
+
+	// Maximum number of channels messages are kept for, defaults to DefaultMaxChannels
+	MaxChannels int
+
+	// How long messages are kept after they were last set, 0 keeps them until evicted
+	TTL time.Duration
+
+	// Whether or not to track in this state
+	Disabled bool
+
+	// Least recently used channel at the back
+	lru *list.List
+
+	channels map[string]*list.Element
+
+	messages map[string]*entry
+
+	// Clock used for TTLs, for tests
+	now func() time.Time
+}
+
+type entry struct {
+	id      string
+	channel string
+
+	// Current version of the message, or the last version if deleted
+	current *types.Message
+
+	// Version of the message before its last update
+	previous *types.Message
+
+	deleted bool
+
+	expires time.Time
+}
+
+type channelBuffer struct {
+	id string
+
+	// Ring buffer of message entries, next is the slot to write to
+	ring []*entry
+	next int
+}
+
+// Initialize the state
+func (s *MessageStore) Init() *MessageStore {
+	s.lru = list.New()
+	s.channels = make(map[string]*list.Element)
+	s.messages = make(map[string]*entry)
+
+	if s.now == nil {
+		s.now = time.Now
+	}
+
+	return s
+}
+
+// Is the state usable
+func (s *MessageStore) Usable() bool {
+	return !s.Disabled
+}
+
+func (s *MessageStore) perChannel() int {
+	if s.PerChannel <= 0 {
+		return DefaultPerChannel
+	}
+
+	return s.PerChannel
+}
+
+func (s *MessageStore) maxChannels() int {
+	if s.MaxChannels <= 0 {
+		return DefaultMaxChannels
+	}
+
+	return s.MaxChannels
+}
+
+// Returns the entry of a message if it has not expired, expired entries are removed
+//
+// Must be called with the lock held
+func (s *MessageStore) entry(id string) *entry {
+	if s.messages == nil {
+		s.Init()
+	}
+
+	e, ok := s.messages[id]
+
+	if !ok {
+		return nil
+	}
+
+	if !e.expires.IsZero() && !s.now().Before(e.expires) {
+		delete(s.messages, id)
+		return nil
+	}
+
+	return e
+}
+
+// Get a message from the state
+func (s *MessageStore) Get(id string) (*types.Message, error) {
+	if s.Disabled {
+		return nil, store.ErrDisabled
+	}
+
+	if id == "" {
+		return nil, store.ErrIdInvalid
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	e := s.entry(id)
+
+	if e == nil || e.deleted {
+		return nil, store.ErrNotFound
+	}
+
+	return e.current, nil
+}
+
+// Set a message in the state, updating it if it is already cached
+func (s *MessageStore) Set(id string, m *types.Message) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	if id == "" {
+		return store.ErrIdInvalid
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var expires time.Time
+	if s.TTL > 0 {
+		expires = s.now().Add(s.TTL)
+	}
+
+	if e := s.entry(id); e != nil {
+		// Only edits are kept, so reactions and embeds added later on don't replace
+		// the content before the last edit
+		if !e.deleted && edited(e.current, m) {
+			e.previous = e.current
+		}
+
+		e.current = m
+		e.deleted = false
+		e.expires = expires
+
+		if el, ok := s.channels[e.channel]; ok {
+			s.lru.MoveToFront(el)
+		}
+
+		return nil
+	}
+
+	e := &entry{
+		id:      id,
+		channel: m.Channel,
+		current: m,
+		expires: expires,
+	}
+
+	s.channel(m.Channel).push(s, e)
+	s.messages[id] = e
+
+	return nil
+}
+
+// Returns whether the content of a message was edited between two versions
+func edited(before, after *types.Message) bool {
+	return before.Content != after.Content || !before.Edited.Equal(after.Edited.Time)
+}
+
+// Returns the buffer of a channel, creating it and evicting the least recently used
+// channel if needed
+//
+// Must be called with the lock held
+func (s *MessageStore) channel(id string) *channelBuffer {
+	if el, ok := s.channels[id]; ok {
+		s.lru.MoveToFront(el)
+		return el.Value.(*channelBuffer)
+	}
+
+	for s.lru.Len() >= s.maxChannels() {
+		oldest := s.lru.Back()
+		s.evictChannel(oldest.Value.(*channelBuffer))
+	}
+
+	c := &channelBuffer{
+		id:   id,
+		ring: make([]*entry, s.perChannel()),
+	}
+
+	s.channels[id] = s.lru.PushFront(c)
+
+	return c
+}
+
+// Must be called with the lock held
+func (s *MessageStore) evictChannel(c *channelBuffer) {
+	for _, e := range c.ring {
+		s.forget(e)
+	}
+
+	s.lru.Remove(s.channels[c.id])
+	delete(s.channels, c.id)
+}
+
+// Removes an entry from the index unless it was replaced
+//
+// Must be called with the lock held
+func (s *MessageStore) forget(e *entry) {
+	if e != nil && s.messages[e.id] == e {
+		delete(s.messages, e.id)
+	}
+}
+
+// Adds an entry to the ring, evicting the oldest entry if the ring is full
+func (c *channelBuffer) push(s *MessageStore, e *entry) {
+	s.forget(c.ring[c.next])
+	c.ring[c.next] = e
+	c.next = (c.next + 1) % len(c.ring)
+}
+
+// Delete a message from the state
+//
+// The last version of the message is kept until it is evicted, see GetDeleted
+func (s *MessageStore) Delete(id string) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	if id == "" {
+		return store.ErrIdInvalid
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if e := s.entry(id); e != nil {
+		e.deleted = true
+	}
+
+	return nil
+}
+
+// Removes every message for which fn returns true for its current, previous or
+// deleted version, leaving no history of it
+//
+// fn must not use the store
+func (s *MessageStore) EvictWhere(fn func(id string, m *types.Message) bool) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for id, e := range s.messages {
+		if fn(id, e.current) || (e.previous != nil && fn(id, e.previous)) {
+			// The ring slot is skipped from now on as the entry is no longer indexed
+			delete(s.messages, id)
+		}
+	}
+
+	return nil
+}
+
+// Returns the message before its last edit along with its current version
+func (s *MessageStore) GetRevision(id string) (*types.Message, *types.Message, error) {
+	if s.Disabled {
+		return nil, nil, store.ErrDisabled
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	e := s.entry(id)
+
+	if e == nil || e.deleted {
+		return nil, nil, store.ErrNotFound
+	}
+
+	return e.previous, e.current, nil
+}
+
+// Returns the last version of a deleted message
+func (s *MessageStore) GetDeleted(id string) (*types.Message, error) {
+	if s.Disabled {
+		return nil, store.ErrDisabled
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	e := s.entry(id)
+
+	if e == nil || !e.deleted {
+		return nil, store.ErrNotFound
+	}
+
+	return e.current, nil
+}
+
+// Returns the cached messages of a channel, oldest first
+func (s *MessageStore) ChannelMessages(channel string) []*types.Message {
+	s.Lock()
+	defer s.Unlock()
+
+	el, ok := s.channels[channel]
+
+	if !ok {
+		return nil
+	}
+
+	c := el.Value.(*channelBuffer)
+
+	var msgs []*types.Message
+	for i := range c.ring {
+		e := c.ring[(c.next+i)%len(c.ring)]
+
+		if e != nil && s.entry(e.id) == e && !e.deleted {
+			msgs = append(msgs, e.current)
+		}
+	}
+
+	return msgs
+}
+
+// Calls fn for every cached message whose ID starts with prefix, stopping if fn returns false
+func (s *MessageStore) ScanPrefix(prefix string, fn func(id string, m *types.Message) bool) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	s.Lock()
+
+	var ids []string
+	var msgs []*types.Message
+	for id := range s.messages {
+		if e := s.entry(id); e != nil && !e.deleted && strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+			msgs = append(msgs, e.current)
+		}
+	}
+
+	s.Unlock()
+
+	// fn is called without the lock held so it may modify the store
+	for i, id := range ids {
+		if !fn(id, msgs[i]) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Returns the number of cached messages, excluding deleted messages
+func (s *MessageStore) Length() int {
+	s.Lock()
+	defer s.Unlock()
+
+	var n int
+	for id := range s.messages {
+		if e := s.entry(id); e != nil && !e.deleted {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,212 @@
+package messagestore
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+func message(channel string, i int) *types.Message {
+	return &types.Message{Id: channel + "-" + strconv.Itoa(i), Channel: channel, Content: "message " + strconv.Itoa(i)}
+}
+
+func TestRingBuffer(t *testing.T) {
+	s := &MessageStore{PerChannel: 3}
+
+	for i := 0; i < 5; i++ {
+		m := message("a", i)
+		s.Set(m.Id, m)
+	}
+
+	if _, err := s.Get("a-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("oldest messages were not evicted")
+	}
+
+	msgs := s.ChannelMessages("a")
+
+	if len(msgs) != 3 || msgs[0].Id != "a-2" || msgs[2].Id != "a-4" {
+		t.Fatalf("unexpected channel messages %v", msgs)
+	}
+
+	if s.Length() != 3 {
+		t.Fatalf("expected 3 messages, got %d", s.Length())
+	}
+
+	// Updating a message doesn't take another slot
+	s.Set("a-2", &types.Message{Id: "a-2", Channel: "a", Content: "edited"})
+
+	if m, _ := s.Get("a-2"); m.Content != "edited" || len(s.ChannelMessages("a")) != 3 {
+		t.Fatal("message was not updated in place")
+	}
+}
+
+func TestChannelLRU(t *testing.T) {
+	s := &MessageStore{PerChannel: 2, MaxChannels: 2}
+
+	for _, c := range []string{"a", "b"} {
+		m := message(c, 0)
+		s.Set(m.Id, m)
+	}
+
+	// Writing to a refreshes it, so b is the least recently used channel
+	s.Set("a-0", message("a", 0))
+
+	m := message("c", 0)
+	s.Set(m.Id, m)
+
+	if _, err := s.Get("b-0"); err == nil {
+		t.Fatal("least recently used channel was not evicted")
+	}
+
+	for _, id := range []string{"a-0", "c-0"} {
+		if _, err := s.Get(id); err != nil {
+			t.Fatalf("message %s was evicted", id)
+		}
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	s := &MessageStore{TTL: time.Minute, now: func() time.Time { return now }}
+
+	m := message("a", 0)
+	s.Set(m.Id, m)
+
+	now = now.Add(30 * time.Second)
+
+	if _, err := s.Get(m.Id); err != nil {
+		t.Fatal("message expired early")
+	}
+
+	// Setting a message refreshes its TTL
+	s.Set(m.Id, m)
+	now = now.Add(45 * time.Second)
+
+	if _, err := s.Get(m.Id); err != nil {
+		t.Fatal("message TTL was not refreshed")
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, err := s.Get(m.Id); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("message did not expire")
+	}
+
+	if s.Length() != 0 || len(s.ChannelMessages("a")) != 0 {
+		t.Fatal("expired message is still listed")
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	var s store.Versioned[types.Message] = &MessageStore{}
+	ms := s.(*MessageStore)
+
+	ms.Set("m", &types.Message{Id: "m", Channel: "a", Content: "first"})
+
+	before, after, err := s.GetRevision("m")
+
+	if err != nil || before != nil || after.Content != "first" {
+		t.Fatalf("unexpected revision %v %v %v", before, after, err)
+	}
+
+	ms.Set("m", &types.Message{Id: "m", Channel: "a", Content: "second"})
+	ms.Set("m", &types.Message{Id: "m", Channel: "a", Content: "third"})
+
+	before, after, _ = s.GetRevision("m")
+
+	if before.Content != "second" || after.Content != "third" {
+		t.Fatalf("unexpected revision %v %v", before, after)
+	}
+
+	if _, err := s.GetDeleted("m"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("message is not deleted")
+	}
+
+	ms.Delete("m")
+
+	if _, err := ms.Get("m"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("deleted message is still returned")
+	}
+
+	if m, err := s.GetDeleted("m"); err != nil || m.Content != "third" {
+		t.Fatal("deleted message was not kept")
+	}
+
+	if _, _, err := s.GetRevision("m"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("deleted message has a revision")
+	}
+}
+
+func TestRevisionIgnoresReactions(t *testing.T) {
+	s := &MessageStore{}
+
+	s.Set("m", &types.Message{Id: "m", Channel: "a", Content: "first"})
+	s.Set("m", &types.Message{Id: "m", Channel: "a", Content: "second"})
+	s.Set("m", &types.Message{Id: "m", Channel: "a", Content: "second", Reactions: map[string][]string{"e": {"u"}}})
+
+	before, after, err := s.GetRevision("m")
+
+	if err != nil || before.Content != "first" || len(after.Reactions) != 1 {
+		t.Fatalf("unexpected revision %v %v %v", before, after, err)
+	}
+}
+
+func TestEvictWhere(t *testing.T) {
+	var s store.Evicter[types.Message] = &MessageStore{}
+	ms := s.(*MessageStore)
+
+	ms.Set("a", &types.Message{Id: "a", Channel: "c", Author: "wiped", Content: "deleted"})
+	ms.Delete("a")
+	ms.Set("b", &types.Message{Id: "b", Channel: "c", Author: "wiped", Content: "edited"})
+	ms.Set("b", &types.Message{Id: "b", Channel: "c", Author: "other", Content: "edited again"})
+	ms.Set("c", &types.Message{Id: "c", Channel: "c", Author: "other"})
+
+	err := s.EvictWhere(func(_ string, m *types.Message) bool {
+		return m.Author == "wiped"
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ms.GetDeleted("a"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("deleted message was not evicted")
+	}
+
+	if _, _, err := ms.GetRevision("b"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatal("message with a matching previous version was not evicted")
+	}
+
+	if _, err := ms.Get("c"); err != nil || ms.Length() != 1 || len(ms.ChannelMessages("c")) != 1 {
+		t.Fatal("unrelated message was evicted")
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	s := &MessageStore{}
+
+	for i := 0; i < 3; i++ {
+		m := message("a", i)
+		s.Set(m.Id, m)
+	}
+
+	s.Delete("a-1")
+
+	var ids []string
+	err := s.ScanPrefix("", func(id string, m *types.Message) bool {
+		ids = append(ids, id)
+
+		// The store may be modified while scanning
+		s.Delete(id)
+		return true
+	})
+
+	if err != nil || len(ids) != 2 || s.Length() != 0 {
+		t.Fatalf("unexpected scan %v: %v", ids, err)
+	}
+}
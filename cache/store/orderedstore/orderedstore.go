@@ -1,6 +1,7 @@
 package orderedstore
 
 import (
+	"strings"
 	"sync"
 
 	"github.com/infinitybotlist/grevolt/cache/store"
@@ -88,6 +89,30 @@ func (s *OrderedStore[T]) Delete(id string) error {
 	return nil
 }
 
+// Calls fn for every entity whose ID starts with prefix in insert order, stopping if fn returns false
+//
+// This scans the whole store
+func (s *OrderedStore[T]) ScanPrefix(prefix string, fn func(id string, entity *T) bool) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.dataStore == nil {
+		return nil
+	}
+
+	for pair := s.dataStore.Oldest(); pair != nil; pair = pair.Next() {
+		if strings.HasPrefix(pair.Key, prefix) && !fn(pair.Key, pair.Value) {
+			break
+		}
+	}
+
+	return nil
+}
+
 // Returns the length of the store
 func (s *OrderedStore[T]) Length() int {
 	return s.dataStore.Len()
@@ -0,0 +1,416 @@
+// Package redisstore provides a store backed by Redis (or any server implementing the
+// Redis protocol) allowing multiple processes to share the same state
+package redisstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Serialization used to store entities
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(b []byte, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v any) error {
+	return json.Unmarshal(b, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.SetOmitEmpty(true)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(b []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// Stores entities as JSON, readable by other tools
+var JSON Codec = jsonCodec{}
+
+// Stores entities as msgpack, which is smaller and faster to decode than JSON
+var Msgpack Codec = msgpackCodec{}
+
+// Number of keys fetched at once when scanning
+const scanBatch = 100
+
+// A store keeping each entity under its own key
+type RedisStore[T any] struct {
+	// The redis client to use, this may be a cluster client
+	Client redis.UniversalClient
+
+	// Prefix for all keys of this store, such as "grevolt:users:"
+	//
+	// Every entity type must use its own prefix
+	Prefix string
+
+	// Serialization to use, defaults to JSON
+	Codec Codec
+
+	// How long entities are kept after they were last set, 0 keeps them forever
+	TTL time.Duration
+
+	// Timeout of every redis operation, 0 means no timeout
+	Timeout time.Duration
+
+	// Whether or not to track in this state
+	Disabled bool
+}
+
+// New returns a new redis-backed store using JSON
+func New[T any](client redis.UniversalClient, prefix string) *RedisStore[T] {
+	return &RedisStore[T]{
+		Client: client,
+		Prefix: prefix,
+		Codec:  JSON,
+	}
+}
+
+// Options for NewState
+type Options struct {
+	// Prefix for all keys, defaults to "grevolt:state:"
+	//
+	// Each entity type is stored under its own prefix below this, such as "grevolt:state:users:"
+	Prefix string
+
+	// Serialization to use, defaults to JSON
+	Codec Codec
+
+	// How long entities are kept after they were last set, 0 keeps them forever
+	TTL time.Duration
+}
+
+// NewState returns a state storing users, servers, channels, members, emojis and
+// webhooks in redis
+//
+// Processes using the same redis server and prefix share their state. Messages are not
+// stored, set State.Messages to a store of your choice to cache them.
+func NewState(client redis.UniversalClient, opts Options) *state.State {
+	if opts.Prefix == "" {
+		opts.Prefix = "grevolt:state:"
+	}
+
+	return &state.State{
+		Users:    newStore[types.User](client, opts, "users:"),
+		Servers:  newStore[types.Server](client, opts, "servers:"),
+		Channels: newStore[types.Channel](client, opts, "channels:"),
+		Members:  newStore[types.Member](client, opts, "members:"),
+		Emojis:   newStore[types.Emoji](client, opts, "emojis:"),
+		Webhooks: newStore[types.Webhook](client, opts, "webhooks:"),
+	}
+}
+
+func newStore[T any](client redis.UniversalClient, opts Options, prefix string) *RedisStore[T] {
+	s := New[T](client, opts.Prefix+prefix)
+	s.TTL = opts.TTL
+
+	if opts.Codec != nil {
+		s.Codec = opts.Codec
+	}
+
+	return s
+}
+
+func (s *RedisStore[T]) codec() Codec {
+	if s.Codec == nil {
+		return JSON
+	}
+
+	return s.Codec
+}
+
+func (s *RedisStore[T]) ctx() (context.Context, context.CancelFunc) {
+	if s.Timeout > 0 {
+		return context.WithTimeout(context.Background(), s.Timeout)
+	}
+
+	return context.Background(), func() {}
+}
+
+// Is the state usable
+func (s *RedisStore[T]) Usable() bool {
+	return !s.Disabled && s.Client != nil
+}
+
+// Get an entity from the state
+func (s *RedisStore[T]) Get(id string) (*T, error) {
+	if s.Disabled {
+		return nil, store.ErrDisabled
+	}
+
+	if id == "" {
+		return nil, store.ErrIdInvalid
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	b, err := s.Client.Get(ctx, s.Prefix+id).Bytes()
+
+	if errors.Is(err, redis.Nil) {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entity T
+	if err := s.codec().Unmarshal(b, &entity); err != nil {
+		return nil, err
+	}
+
+	return &entity, nil
+}
+
+// Set an entity in the state
+func (s *RedisStore[T]) Set(id string, entity *T) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	if id == "" {
+		return store.ErrIdInvalid
+	}
+
+	b, err := s.codec().Marshal(entity)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	return s.Client.Set(ctx, s.Prefix+id, b, s.TTL).Err()
+}
+
+// Delete an entity from the state
+func (s *RedisStore[T]) Delete(id string) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	if id == "" {
+		return store.ErrIdInvalid
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	return s.Client.Del(ctx, s.Prefix+id).Err()
+}
+
+// Calls fn for every entity whose ID starts with prefix, stopping if fn returns false
+//
+// This uses SCAN, entities set or deleted while scanning may or may not be seen. On a
+// cluster, every master is scanned in turn.
+func (s *RedisStore[T]) ScanPrefix(prefix string, fn func(id string, entity *T) bool) error {
+	if s.Disabled {
+		return store.ErrDisabled
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	nodes, err := s.nodes(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, escapePattern(s.Prefix+prefix)+"*", scanBatch).Result()
+
+			if err != nil {
+				return err
+			}
+
+			vals, err := s.getMany(ctx, keys)
+
+			if err != nil {
+				return err
+			}
+
+			for i, v := range vals {
+				if v == nil {
+					// Deleted since the scan
+					continue
+				}
+
+				var entity T
+				if err := s.codec().Unmarshal(v, &entity); err != nil {
+					return err
+				}
+
+				if !fn(strings.TrimPrefix(keys[i], s.Prefix), &entity) {
+					return nil
+				}
+			}
+
+			if next == 0 {
+				break
+			}
+
+			cursor = next
+		}
+	}
+
+	return nil
+}
+
+// Returns the length of the store
+//
+// This scans all keys of the store, 0 is returned if redis can't be reached
+func (s *RedisStore[T]) Length() int {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	nodes, err := s.nodes(ctx)
+
+	if err != nil {
+		return 0
+	}
+
+	var n int
+	for _, node := range nodes {
+		iter := node.Scan(ctx, 0, escapePattern(s.Prefix)+"*", scanBatch).Iterator()
+
+		for iter.Next(ctx) {
+			n++
+		}
+
+		if iter.Err() != nil {
+			return 0
+		}
+	}
+
+	return n
+}
+
+// Returns the clients keys must be scanned on
+//
+// SCAN only returns the keys of the node it is sent to, so on a cluster this is every master
+func (s *RedisStore[T]) nodes(ctx context.Context) ([]redis.Cmdable, error) {
+	cluster, ok := s.Client.(*redis.ClusterClient)
+
+	if !ok {
+		return []redis.Cmdable{s.Client}, nil
+	}
+
+	var mu sync.Mutex
+	var nodes []redis.Cmdable
+
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		nodes = append(nodes, client)
+		return nil
+	})
+
+	return nodes, err
+}
+
+// Returns the values of keys, nil for keys that don't exist
+//
+// On a cluster, keys may be in different hash slots which MGET does not allow, so every
+// key is fetched on its own in a pipeline instead
+func (s *RedisStore[T]) getMany(ctx context.Context, keys []string) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	vals := make([][]byte, len(keys))
+
+	if _, ok := s.Client.(*redis.ClusterClient); !ok {
+		res, err := s.Client.MGet(ctx, keys...).Result()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i, v := range res {
+			if str, ok := v.(string); ok {
+				vals[i] = []byte(str)
+			}
+		}
+
+		return vals, nil
+	}
+
+	cmds := make([]*redis.StringCmd, len(keys))
+
+	_, err := s.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = p.Get(ctx, key)
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		b, err := cmd.Bytes()
+
+		if errors.Is(err, redis.Nil) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		vals[i] = b
+	}
+
+	return vals, nil
+}
+
+// Escapes glob characters in a SCAN pattern
+func escapePattern(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,268 @@
+package redisstore
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/infinitybotlist/grevolt/types/timestamp"
+	"github.com/redis/go-redis/v9"
+)
+
+// Starts a local redis server, returning it along with a client connected to it
+func newClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	srv := miniredis.RunT(t)
+	return srv, redis.NewClient(&redis.Options{Addr: srv.Addr()})
+}
+
+// Ensure RedisStore can be used in place of the in-memory stores
+var (
+	_ store.Store[types.User]         = (*RedisStore[types.User])(nil)
+	_ store.PrefixScanner[types.User] = (*RedisStore[types.User])(nil)
+)
+
+func TestRoundTrip(t *testing.T) {
+	joined := timestamp.Timestamp{Time: time.UnixMilli(1690000000000).UTC()}
+
+	for name, codec := range map[string]Codec{"json": JSON, "msgpack": Msgpack} {
+		t.Run(name, func(t *testing.T) {
+			srv, client := newClient(t)
+
+			users := New[types.User](client, "users:")
+			users.Codec = codec
+
+			u := &types.User{
+				Id:       "01H0000000000000000000USER",
+				Username: "grevolt",
+				Avatar:   &types.File{Id: "avatar", Tag: "avatars"},
+				Status:   &types.UserStatus{Text: "hello"},
+				Online:   true,
+			}
+
+			if err := users.Set(u.Id, u); err != nil {
+				t.Fatal(err)
+			}
+
+			if !srv.Exists("users:" + u.Id) {
+				t.Fatal("user not stored under its prefix")
+			}
+
+			got, err := users.Get(u.Id)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Username != u.Username || got.Avatar == nil || got.Avatar.Id != "avatar" || got.Status == nil || got.Status.Text != "hello" || !got.Online {
+				t.Fatalf("got %+v, want %+v", got, u)
+			}
+
+			members := New[types.Member](client, "members:")
+			members.Codec = codec
+
+			m := &types.Member{
+				Id:       &types.MemberId{Server: "server", User: u.Id},
+				JoinedAt: joined,
+				Roles:    []string{"a", "b"},
+			}
+
+			if err := members.Set("server/"+u.Id, m); err != nil {
+				t.Fatal(err)
+			}
+
+			gotMember, err := members.Get("server/" + u.Id)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !gotMember.JoinedAt.Equal(joined.Time) || len(gotMember.Roles) != 2 || gotMember.Id.User != u.Id {
+				t.Fatalf("got %+v, want %+v", gotMember, m)
+			}
+
+			if err := users.Delete(u.Id); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := users.Get(u.Id); !errors.Is(err, store.ErrNotFound) {
+				t.Fatalf("expected ErrNotFound after delete, got %v", err)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, client := newClient(t)
+
+	s := New[types.User](client, "users:")
+
+	if _, err := s.Get("missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := s.Get(""); !errors.Is(err, store.ErrIdInvalid) {
+		t.Fatalf("expected ErrIdInvalid, got %v", err)
+	}
+
+	s.Disabled = true
+
+	if s.Usable() {
+		t.Fatal("disabled store is usable")
+	}
+
+	if err := s.Set("id", &types.User{}); !errors.Is(err, store.ErrDisabled) {
+		t.Fatalf("expected ErrDisabled, got %v", err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	srv, client := newClient(t)
+
+	s := New[types.Channel](client, "channels:")
+	s.TTL = time.Minute
+
+	if err := s.Set("channel", &types.Channel{Id: "channel"}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.FastForward(30 * time.Second)
+
+	if _, err := s.Get("channel"); err != nil {
+		t.Fatalf("channel expired early: %v", err)
+	}
+
+	srv.FastForward(time.Minute)
+
+	if _, err := s.Get("channel"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected channel to expire, got %v", err)
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	t.Run("client", func(t *testing.T) {
+		_, client := newClient(t)
+		testScanPrefix(t, client)
+	})
+
+	// miniredis serves every hash slot, so it can be used as a single node cluster
+	t.Run("cluster", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		testScanPrefix(t, redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{srv.Addr()}}))
+	})
+}
+
+func testScanPrefix(t *testing.T, client redis.UniversalClient) {
+	members := New[types.Member](client, "members:")
+
+	// More than one SCAN batch, plus keys that must not match
+	for i := 0; i < scanBatch+20; i++ {
+		id := "user" + strconv.Itoa(i)
+		members.Set("server/"+id, &types.Member{Id: &types.MemberId{Server: "server", User: id}})
+	}
+
+	members.Set("other/user", &types.Member{Id: &types.MemberId{Server: "other", User: "user"}})
+	members.Set("serv*/user", &types.Member{Id: &types.MemberId{Server: "serv*", User: "user"}})
+
+	var ids []string
+	err := members.ScanPrefix("server/", func(id string, m *types.Member) bool {
+		if m.Id.Server != "server" || id != "server/"+m.Id.User {
+			t.Fatalf("unexpected member %s: %+v", id, m.Id)
+		}
+
+		ids = append(ids, id)
+		return true
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != scanBatch+20 {
+		t.Fatalf("got %d members, want %d", len(ids), scanBatch+20)
+	}
+
+	// Glob characters in the prefix are matched literally
+	var globbed []string
+	members.ScanPrefix("serv*/", func(id string, m *types.Member) bool {
+		globbed = append(globbed, id)
+		return true
+	})
+
+	if len(globbed) != 1 || globbed[0] != "serv*/user" {
+		t.Fatalf("got %v, want [serv*/user]", globbed)
+	}
+
+	var n int
+	members.ScanPrefix("", func(id string, m *types.Member) bool {
+		n++
+		return n < 3
+	})
+
+	if n != 3 {
+		t.Fatalf("scan did not stop, fn called %d times", n)
+	}
+
+	if l := members.Length(); l != scanBatch+22 {
+		t.Fatalf("got length %d, want %d", l, scanBatch+22)
+	}
+}
+
+func TestSharedState(t *testing.T) {
+	srv, client := newClient(t)
+
+	a := NewState(client, Options{Codec: Msgpack})
+	b := NewState(redis.NewClient(&redis.Options{Addr: srv.Addr()}), Options{Codec: Msgpack})
+	other := NewState(client, Options{Prefix: "other:"})
+
+	if err := a.AddServer(&types.Server{Id: "server", Name: "Shared"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []string{"u1", "u2"} {
+		if err := a.AddMember(&types.Member{Id: &types.MemberId{Server: "server", User: user}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := b.GetServer("server")
+
+	if err != nil || s.Name != "Shared" {
+		t.Fatalf("server not shared: %+v, %v", s, err)
+	}
+
+	members, err := b.GetServerMembers("server")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []string
+	for _, m := range members {
+		users = append(users, m.Id.User)
+	}
+
+	sort.Strings(users)
+
+	if len(users) != 2 || users[0] != "u1" || users[1] != "u2" {
+		t.Fatalf("got members %v, want [u1 u2]", users)
+	}
+
+	if err := b.PurgeServer("server"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.GetMember("server", "u1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected purged member to be gone, got %v", err)
+	}
+
+	if _, err := other.GetServer("server"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("state with another prefix sees server: %v", err)
+	}
+}
@@ -26,6 +26,41 @@ type Store[T any] interface {
 	Length() int
 }
 
+// Optional interface for stores that can iterate over entities by ID prefix
+//
+// This is used for queries such as fetching all members of a server
+type PrefixScanner[T any] interface {
+	// Calls fn for every entity whose ID starts with prefix, stopping if fn returns false
+	ScanPrefix(prefix string, fn func(id string, entity *T) bool) error
+}
+
+// Optional interface for stores keeping previous versions of updated and deleted entities
+//
+// This is used to show what a message said before it was edited or deleted
+type Versioned[T any] interface {
+	// Returns the entity before its last update along with its current version
+	//
+	// before is nil if the entity was not updated since it was cached
+	GetRevision(id string) (before *T, after *T, err error)
+
+	// Returns the last version of a deleted entity
+	GetDeleted(id string) (*T, error)
+}
+
+// Optional interface for stores keeping history of entities (see Versioned) that can
+// remove all of it
+//
+// This is used when an entity must not be retrievable at all anymore, such as the
+// messages of a user whose data was wiped
+type Evicter[T any] interface {
+	// Removes every entity for which fn returns true for any version kept of it,
+	// including previous versions and deleted entities
+	//
+	// fn must not use the store
+	EvictWhere(fn func(id string, entity *T) bool) error
+}
+
 var ErrNotFound = errors.New("entity not found")
 var ErrDisabled = errors.New("state tracking is disabled")
 var ErrIdInvalid = errors.New("id is invalid")
+var ErrUnsupported = errors.New("operation is not supported by this store")
@@ -20,6 +20,9 @@ type Client struct {
 }
 
 // New returns a new client with default options
+//
+// Messages are not cached by default, set State.Messages to a store such as
+// messagestore.MessageStore to cache them
 func New() *Client {
 	w := zapcore.AddSync(os.Stdout)
 
@@ -42,6 +45,7 @@ func New() *Client {
 		Channels: &basicstore.BasicStore[types.Channel]{},
 		Members:  &basicstore.BasicStore[types.Member]{},
 		Emojis:   &basicstore.BasicStore[types.Emoji]{},
+		Webhooks: &basicstore.BasicStore[types.Webhook]{},
 	}
 
 	rest := restcli.DefaultRestClient(&s)
@@ -55,7 +59,7 @@ func New() *Client {
 	}
 
 	c.Rest.Config.Logger = logger.Named("rest")
-	c.Rest.Config.Ratelimiter.Logger = logger.Named("ratelimiter")
+	c.Rest.Config.Ratelimiter.SetLogger(logger.Named("ratelimiter"))
 	c.Websocket.Logger = logger.Named("websocket")
 
 	return &c
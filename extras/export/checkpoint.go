@@ -0,0 +1,108 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Name of the checkpoint file in the output directory
+const checkpointFile = "checkpoint.json"
+
+// Checkpoint records the progress of an export so that it can be resumed
+type Checkpoint struct {
+	// The channel being exported
+	Channel string `json:"channel"`
+
+	// ID of the last message that was fully written
+	LastMessage string `json:"last_message"`
+
+	// Number of messages written
+	Count int `json:"count"`
+
+	// Number of attachments downloaded
+	Attachments int `json:"attachments"`
+
+	// Attachments that could not be downloaded, the export links to them instead
+	FailedAttachments []FailedAttachment `json:"failed_attachments,omitempty"`
+
+	// Size of each output file after the last message, used to discard partially
+	// written messages when resuming
+	Offsets map[Format]int64 `json:"offsets"`
+
+	// Whether the export reached the end of the channel
+	Complete bool `json:"complete"`
+
+	// When the checkpoint was written
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// An attachment that could not be downloaded, such as one deleted from Autumn
+type FailedAttachment struct {
+	// The message the attachment belongs to
+	Message string `json:"message"`
+
+	// The attachment
+	Attachment string `json:"attachment"`
+
+	// Why the download failed
+	Error string `json:"error"`
+}
+
+// LoadCheckpoint loads the checkpoint of an export in dir, returning nil if there is none
+func LoadCheckpoint(dir string) (*Checkpoint, error) {
+	f, err := os.ReadFile(filepath.Join(dir, checkpointFile))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var c Checkpoint
+	if err := json.Unmarshal(f, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Atomically writes the checkpoint to dir
+func (c *Checkpoint) save(dir string) error {
+	c.UpdatedAt = time.Now()
+
+	b, err := json.MarshalIndent(c, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, checkpointFile+".tmp")
+
+	f, err := os.Create(tmp)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	// Make sure the checkpoint is on disk before replacing the old one
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(dir, checkpointFile))
+}
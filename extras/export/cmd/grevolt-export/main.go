@@ -0,0 +1,74 @@
+// Command grevolt-export exports the message history of a channel
+//
+//	grevolt-export -token $TOKEN -channel 01G11DTVYAJQCJJ9VZMA6GRND3 -out ./archive -attachments
+//
+// Running the same command again resumes the export from where it stopped
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/infinitybotlist/grevolt/auth"
+	"github.com/infinitybotlist/grevolt/client"
+	"github.com/infinitybotlist/grevolt/extras/export"
+)
+
+func main() {
+	token := flag.String("token", os.Getenv("REVOLT_TOKEN"), "session or bot token, defaults to $REVOLT_TOKEN")
+	user := flag.Bool("user", false, "whether the token is a user session token")
+	api := flag.String("api", "", "url of the revolt api, defaults to the official instance")
+	channel := flag.String("channel", "", "id of the channel to export")
+	out := flag.String("out", "", "output directory, defaults to the channel id")
+	formats := flag.String("formats", "jsonl,html,txt", "comma-separated list of formats to write")
+	attachments := flag.Bool("attachments", false, "download attachments")
+
+	flag.Parse()
+
+	if *token == "" || *channel == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *out == "" {
+		*out = *channel
+	}
+
+	var fs []export.Format
+	for _, f := range strings.Split(*formats, ",") {
+		fs = append(fs, export.Format(strings.TrimSpace(f)))
+	}
+
+	c := client.New()
+	c.Authorize(&auth.Token{
+		Bot:   !*user,
+		Token: *token,
+	})
+
+	if *api != "" {
+		c.Rest.Config.APIUrl = strings.TrimSuffix(*api, "/") + "/"
+	}
+
+	cp, err := export.Export(c.Rest, export.Options{
+		Channel:             *channel,
+		Dir:                 *out,
+		Formats:             fs,
+		DownloadAttachments: *attachments,
+		OnProgress: func(cp *export.Checkpoint) {
+			fmt.Fprintf(os.Stderr, "exported %d messages (last %s)\n", cp.Count, cp.LastMessage)
+		},
+	})
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export failed, run again to resume:", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d messages and %d attachments to %s\n", cp.Count, cp.Attachments, *out)
+
+	for _, f := range cp.FailedAttachments {
+		fmt.Fprintf(os.Stderr, "failed to download attachment %s of message %s: %s\n", f.Attachment, f.Message, f.Error)
+	}
+}
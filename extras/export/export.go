@@ -0,0 +1,396 @@
+// Package export archives the message history of a channel as JSON Lines, a HTML
+// transcript and/or a plain-text transcript
+//
+// Exports are resumable, progress is checkpointed to the output directory and
+// running an export again continues from the last checkpointed message
+package export
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
+	"github.com/infinitybotlist/grevolt/rest/restcli"
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/infinitybotlist/grevolt/types/timestamp"
+	"go.uber.org/zap"
+)
+
+// Options for an export
+type Options struct {
+	// The channel to export
+	Channel string
+
+	// Directory to write the export to, this is created if it does not exist
+	Dir string
+
+	// Formats to write, defaults to all formats
+	Formats []Format
+
+	// Whether to download attachments to the attachments directory of the export
+	//
+	// Otherwise, attachments are linked to using their Autumn URL
+	DownloadAttachments bool
+
+	// URL of Autumn (the file server), defaults to the URL returned by the API
+	AutumnURL string
+
+	// HTTP client to download attachments with, defaults to the rest clients http client
+	HTTPClient *http.Client
+
+	// How often to write a checkpoint, defaults to every 100 messages
+	CheckpointEvery int
+
+	// Called after every checkpoint
+	OnProgress func(c *Checkpoint)
+
+	// Logger to use, defaults to the rest clients logger
+	Logger *zap.Logger
+}
+
+// An output file of an export
+type output struct {
+	format formatWriter
+	file   *os.File
+	buf    *bufio.Writer
+	size   int64
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	n, err := o.buf.Write(p)
+	o.size += int64(n)
+	return n, err
+}
+
+// Export exports a channel using the given rest client, resuming a previous export
+// to the same directory if there is one
+//
+// The export is done oldest message first and in the background priority, so other
+// requests made by the rest client are not delayed by the export
+//
+// Attachments that fail to download don't stop the export, they are linked to instead
+// and recorded in Checkpoint.FailedAttachments
+func Export(c *restcli.RestClient, opts Options) (*Checkpoint, error) {
+	if opts.Channel == "" || opts.Dir == "" {
+		return nil, errors.New("channel and output directory must be set")
+	}
+
+	if len(opts.Formats) == 0 {
+		opts.Formats = Formats
+	}
+
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = 100
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = c.Config.Logger
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	c = c.WithPriority(ratelimits.PriorityBackground)
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	cp, err := LoadCheckpoint(opts.Dir)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	if cp != nil && cp.Channel != opts.Channel {
+		return nil, fmt.Errorf("output directory contains an export of channel %s", cp.Channel)
+	}
+
+	if cp == nil {
+		cp = &Checkpoint{Channel: opts.Channel}
+	}
+
+	if cp.Offsets == nil {
+		cp.Offsets = make(map[Format]int64)
+	}
+
+	if opts.AutumnURL == "" {
+		node, err := c.QueryNode()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to query node for autumn url: %w", err)
+		}
+
+		if node.Features != nil && node.Features.Autumn != nil {
+			opts.AutumnURL = node.Features.Autumn.Url
+		}
+	}
+
+	outputs, err := openOutputs(opts, cp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		for _, o := range outputs {
+			o.file.Close()
+		}
+	}()
+
+	if cp.LastMessage != "" {
+		opts.Logger.Info("Resuming export", zap.String("channel", opts.Channel), zap.String("after", cp.LastMessage), zap.Int("count", cp.Count))
+	}
+
+	cp.Complete = false
+
+	it := c.MessageHistory(opts.Channel, restcli.HistoryOptions{
+		Direction:    restcli.HistoryForward,
+		After:        cp.LastMessage,
+		IncludeUsers: true,
+	})
+
+	var pending int
+	for it.Next() {
+		msg := it.Message()
+
+		e := &Entry{
+			Message: msg,
+			User:    it.User(msg.Author),
+			Member:  it.Member(msg.Author),
+		}
+
+		for _, a := range msg.Attachments {
+			f, err := attachment(c, opts, a)
+
+			switch {
+			case err != nil:
+				// Retrying won't help if the attachment was deleted, link to it and carry on
+				opts.Logger.Warn("Failed to download attachment", zap.String("message", msg.Id), zap.String("attachment", a.Id), zap.Error(err))
+
+				f = attachmentURL(opts, a)
+				e.FailedAttachments = append(e.FailedAttachments, a.Id)
+				cp.FailedAttachments = append(cp.FailedAttachments, FailedAttachment{
+					Message:    msg.Id,
+					Attachment: a.Id,
+					Error:      err.Error(),
+				})
+			case opts.DownloadAttachments:
+				cp.Attachments++
+			}
+
+			e.Files = append(e.Files, f)
+		}
+
+		for _, o := range outputs {
+			if err := o.format.entry(o, e); err != nil {
+				return cp, err
+			}
+		}
+
+		cp.LastMessage = msg.Id
+		cp.Count++
+		pending++
+
+		if pending >= opts.CheckpointEvery {
+			if err := checkpoint(opts, cp, outputs); err != nil {
+				return cp, err
+			}
+
+			pending = 0
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		// Save what we have so the export can be resumed
+		if cerr := checkpoint(opts, cp, outputs); cerr != nil {
+			opts.Logger.Error("Failed to save checkpoint", zap.Error(cerr))
+		}
+
+		return cp, err
+	}
+
+	if err := checkpoint(opts, cp, outputs); err != nil {
+		return cp, err
+	}
+
+	// The footers are written after the checkpoint, so resuming discards them
+	for _, o := range outputs {
+		if err := o.format.footer(o); err != nil {
+			return cp, err
+		}
+
+		if err := o.buf.Flush(); err != nil {
+			return cp, err
+		}
+	}
+
+	cp.Complete = true
+
+	if err := cp.save(opts.Dir); err != nil {
+		return cp, err
+	}
+
+	return cp, nil
+}
+
+// Opens the output files, discarding anything written after the checkpoint
+func openOutputs(opts Options, cp *Checkpoint) ([]*output, error) {
+	var outputs []*output
+
+	for _, f := range opts.Formats {
+		fw, err := newFormatWriter(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := os.OpenFile(filepath.Join(opts.Dir, f.filename()), os.O_CREATE|os.O_RDWR, 0o644)
+
+		if err != nil {
+			return nil, err
+		}
+
+		o := &output{format: fw, file: file}
+		outputs = append(outputs, o)
+
+		offset, ok := cp.Offsets[f]
+
+		if !ok && cp.LastMessage != "" {
+			file.Close()
+			return nil, fmt.Errorf("format %s was not part of the export being resumed", f)
+		}
+
+		if err := file.Truncate(offset); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		o.buf = bufio.NewWriter(file)
+		o.size = offset
+
+		if offset == 0 {
+			if err := fw.header(o, opts.Channel); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return outputs, nil
+}
+
+// Flushes all outputs to disk and saves the checkpoint
+func checkpoint(opts Options, cp *Checkpoint, outputs []*output) error {
+	for i, o := range outputs {
+		if err := o.buf.Flush(); err != nil {
+			return err
+		}
+
+		if err := o.file.Sync(); err != nil {
+			return err
+		}
+
+		cp.Offsets[opts.Formats[i]] = o.size
+	}
+
+	if err := cp.save(opts.Dir); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	if opts.OnProgress != nil {
+		opts.OnProgress(cp)
+	}
+
+	return nil
+}
+
+// Returns the Autumn URL of an attachment
+func attachmentURL(opts Options, a *types.File) string {
+	tag := a.Tag
+	if tag == "" {
+		tag = "attachments"
+	}
+
+	return strings.TrimSuffix(opts.AutumnURL, "/") + "/" + tag + "/" + a.Id
+}
+
+// Downloads an attachment if enabled, returning where it can be found
+func attachment(c *restcli.RestClient, opts Options, a *types.File) (string, error) {
+	url := attachmentURL(opts, a)
+
+	if !opts.DownloadAttachments {
+		return url, nil
+	}
+
+	rel := filepath.Join("attachments", a.Id+"_"+filepath.Base(a.Filename))
+	path := filepath.Join(opts.Dir, rel)
+
+	// Already downloaded before the export was resumed
+	if st, err := os.Stat(path); err == nil && uint64(st.Size()) == a.Size {
+		return rel, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = c.Config.HTTPClient
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	resp, err := client.Get(url)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	// Download to a temporary file so that a crash never leaves a partial attachment
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return rel, os.Rename(tmp, path)
+}
+
+// Returns the time a message was sent at
+func messageTime(m *types.Message) time.Time {
+	t, _ := timestamp.FromULID(m.Id)
+	return t
+}
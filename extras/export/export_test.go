@@ -0,0 +1,280 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/cache/store/basicstore"
+	"github.com/infinitybotlist/grevolt/rest/restcli"
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/infinitybotlist/grevolt/types/timestamp"
+	"go.uber.org/zap"
+)
+
+const testChannel = "01G11DTVYAJQCJJ9VZMA6GRND3"
+
+// Starts a fake API and Autumn serving count messages, every tenth message has an attachment
+//
+// Fetching messages fails while fail is set, the missing attachments are not found
+func exportServer(t *testing.T, count int, fail *atomic.Bool, missing ...string) *restcli.RestClient {
+	t.Helper()
+
+	start := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var msgs []*types.Message
+	for i := 0; i < count; i++ {
+		m := &types.Message{
+			Id:      timestamp.ToULID(start.Add(time.Duration(i) * time.Second)),
+			Channel: testChannel,
+			Author:  "01FD58YK5W7QRV5H3D64KTQYX3",
+			Content: "message <" + strconv.Itoa(i) + ">",
+		}
+
+		if i%10 == 0 {
+			m.Attachments = []*types.File{{Id: "file" + strconv.Itoa(i), Tag: "attachments", Filename: "../file.txt", Size: 5}}
+		}
+
+		msgs = append(msgs, m)
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/" || r.URL.Path == "//":
+			json.NewEncoder(w).Encode(map[string]any{
+				"features": map[string]any{"autumn": map[string]any{"enabled": true, "url": srv.URL + "/autumn"}},
+			})
+		case strings.HasPrefix(r.URL.Path, "/autumn/attachments/"):
+			for _, id := range missing {
+				if r.URL.Path == "/autumn/attachments/"+id {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+			}
+
+			w.Write([]byte("hello"))
+		case r.URL.Path == "/channels/"+testChannel+"/messages":
+			if fail.Load() {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			q := r.URL.Query()
+			limit, _ := strconv.Atoi(q.Get("limit"))
+
+			var page []*types.Message
+			for _, m := range msgs {
+				if (q.Get("before") == "" || m.Id < q.Get("before")) && (q.Get("after") == "" || m.Id > q.Get("after")) {
+					page = append(page, m)
+				}
+			}
+
+			sort.Slice(page, func(i, j int) bool { return page[i].Id < page[j].Id })
+
+			if len(page) > limit {
+				page = page[:limit]
+			}
+
+			json.NewEncoder(w).Encode(map[string]any{
+				"messages": page,
+				"users":    []*types.User{{Id: "01FD58YK5W7QRV5H3D64KTQYX3", Username: "zomatree"}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+
+	c := restcli.DefaultRestClient(&state.State{
+		Users:   &basicstore.BasicStore[types.User]{},
+		Members: &basicstore.BasicStore[types.Member]{},
+	})
+	c.Config.APIUrl = srv.URL + "/"
+	c.Config.Logger = zap.NewNop()
+	c.Config.Ratelimiter.SetLogger(zap.NewNop())
+
+	return c
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	return lines
+}
+
+func TestExportResume(t *testing.T) {
+	var fail atomic.Bool
+	c := exportServer(t, 250, &fail)
+	dir := t.TempDir()
+
+	opts := Options{
+		Channel:             testChannel,
+		Dir:                 dir,
+		DownloadAttachments: true,
+		CheckpointEvery:     30,
+	}
+
+	// Fail after the first page
+	opts.OnProgress = func(cp *Checkpoint) {
+		if cp.Count >= 90 {
+			fail.Store(true)
+		}
+	}
+
+	cp, err := Export(c, opts)
+
+	if err == nil {
+		t.Fatal("expected export to fail")
+	}
+
+	if cp == nil || cp.Complete || cp.Count != 100 {
+		t.Fatalf("unexpected checkpoint after failure %+v: %s", cp, err)
+	}
+
+	// Simulate a crash after writing messages that were never checkpointed
+	f, err := os.OpenFile(filepath.Join(dir, "messages.jsonl"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"message":{"_id":"partial"`)
+	f.Close()
+
+	fail.Store(false)
+	opts.OnProgress = nil
+
+	cp, err = Export(c, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cp.Complete || cp.Count != 250 || cp.Attachments != 25 {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+
+	lines := readLines(t, filepath.Join(dir, "messages.jsonl"))
+
+	if len(lines) != 250 {
+		t.Fatalf("expected 250 messages, got %d", len(lines))
+	}
+
+	seen := map[string]bool{}
+	for _, l := range lines {
+		var e Entry
+		if err := json.Unmarshal([]byte(l), &e); err != nil {
+			t.Fatalf("invalid line %q: %s", l, err)
+		}
+
+		if seen[e.Message.Id] {
+			t.Fatalf("duplicate message %s", e.Message.Id)
+		}
+
+		seen[e.Message.Id] = true
+
+		if e.User == nil || e.User.Username != "zomatree" {
+			t.Fatalf("message %s is missing its author", e.Message.Id)
+		}
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, "transcript.html"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(string(html), "</html>") != 1 || strings.Count(string(html), `class="message"`) != 250 {
+		t.Fatal("html transcript is malformed")
+	}
+
+	if !strings.Contains(string(html), "message &lt;42&gt;") {
+		t.Fatal("html transcript content is not escaped")
+	}
+
+	text := readLines(t, filepath.Join(dir, "transcript.txt"))
+
+	if !strings.HasSuffix(text[2], "zomatree: message <0>") {
+		t.Fatalf("unexpected transcript line %q", text[2])
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "attachments", "file240_file.txt"))
+
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("attachment was not downloaded: %v", err)
+	}
+}
+
+func TestExportMissingAttachment(t *testing.T) {
+	var fail atomic.Bool
+	c := exportServer(t, 50, &fail, "file20")
+	dir := t.TempDir()
+
+	opts := Options{
+		Channel:             testChannel,
+		Dir:                 dir,
+		DownloadAttachments: true,
+	}
+
+	cp, err := Export(c, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cp.Complete || cp.Count != 50 || cp.Attachments != 4 {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+
+	if len(cp.FailedAttachments) != 1 || cp.FailedAttachments[0].Attachment != "file20" || cp.FailedAttachments[0].Error == "" {
+		t.Fatalf("unexpected failed attachments %+v", cp.FailedAttachments)
+	}
+
+	saved, err := LoadCheckpoint(dir)
+
+	if err != nil || len(saved.FailedAttachments) != 1 {
+		t.Fatalf("failed attachment not saved in the checkpoint: %+v, %v", saved, err)
+	}
+
+	lines := readLines(t, filepath.Join(dir, "messages.jsonl"))
+
+	var e Entry
+	if err := json.Unmarshal([]byte(lines[20]), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.FailedAttachments) != 1 || e.FailedAttachments[0] != "file20" || len(e.Files) != 1 || !strings.HasSuffix(e.Files[0], "/autumn/attachments/file20") {
+		t.Fatalf("unexpected entry for the missing attachment: %+v", e)
+	}
+
+	// The export stays complete when run again
+	cp, err = Export(c, opts)
+
+	if err != nil || !cp.Complete || cp.Count != 50 {
+		t.Fatalf("unexpected checkpoint after rerun %+v: %v", cp, err)
+	}
+}
@@ -0,0 +1,198 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// Output format of an export
+type Format string
+
+const (
+	// One JSON object (see Entry) per line
+	FormatJSONL Format = "jsonl"
+
+	// A HTML transcript
+	FormatHTML Format = "html"
+
+	// A plain-text transcript
+	FormatText Format = "txt"
+)
+
+// All formats
+var Formats = []Format{FormatJSONL, FormatHTML, FormatText}
+
+// Returns the name of the output file of the format
+func (f Format) filename() string {
+	switch f {
+	case FormatJSONL:
+		return "messages.jsonl"
+	case FormatHTML:
+		return "transcript.html"
+	default:
+		return "transcript.txt"
+	}
+}
+
+// A message and its author, as written to each format
+type Entry struct {
+	// The message
+	Message *types.Message `json:"message"`
+
+	// The author of the message, if known
+	User *types.User `json:"user,omitempty"`
+
+	// The author of the message as a server member, if known
+	Member *types.Member `json:"member,omitempty"`
+
+	// Files the attachments of the message were downloaded to relative to the output
+	// directory, or their Autumn URLs if attachments are not downloaded
+	Files []string `json:"files,omitempty"`
+
+	// IDs of attachments that could not be downloaded, Files contains their Autumn
+	// URLs instead
+	FailedAttachments []string `json:"failed_attachments,omitempty"`
+}
+
+// Returns the time the message was sent at
+func (e *Entry) time() time.Time {
+	return messageTime(e.Message)
+}
+
+// Returns the name to show for the author of the message
+func (e *Entry) author() string {
+	switch {
+	case e.Message.Masquerade != nil && e.Message.Masquerade.Name != "":
+		return e.Message.Masquerade.Name
+	case e.Message.Webhook != nil:
+		return e.Message.Webhook.Name
+	case e.Member != nil && e.Member.Nickname != "":
+		return e.Member.Nickname
+	case e.User != nil && e.User.DisplayName != "":
+		return e.User.DisplayName
+	case e.User != nil:
+		return e.User.Username
+	default:
+		return e.Message.Author
+	}
+}
+
+// Writes entries in a format
+type formatWriter interface {
+	// Writes the start of a new file
+	header(w io.Writer, channel string) error
+
+	// Writes an entry
+	entry(w io.Writer, e *Entry) error
+
+	// Writes the end of the file, this is discarded when the export is resumed
+	footer(w io.Writer) error
+}
+
+func newFormatWriter(f Format) (formatWriter, error) {
+	switch f {
+	case FormatJSONL:
+		return jsonlWriter{}, nil
+	case FormatHTML:
+		return htmlWriter{}, nil
+	case FormatText:
+		return textWriter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", f)
+	}
+}
+
+type jsonlWriter struct{}
+
+func (jsonlWriter) header(w io.Writer, channel string) error {
+	return nil
+}
+
+func (jsonlWriter) entry(w io.Writer, e *Entry) error {
+	return json.NewEncoder(w).Encode(e)
+}
+
+func (jsonlWriter) footer(w io.Writer) error {
+	return nil
+}
+
+var htmlHeader = template.Must(template.New("header").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Transcript of {{.}}</title>
+<style>
+body { font-family: sans-serif; background: #191919; color: #e9e9e9; }
+.message { padding: 4px 8px; }
+.author { font-weight: bold; }
+.time { color: #8a8a8a; font-size: 0.8em; margin-left: 4px; }
+.content { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Transcript of {{.}}</h1>
+`))
+
+var htmlEntry = template.Must(template.New("entry").Parse(`<div class="message" id="{{.Message.Id}}">
+<span class="author">{{.Author}}</span><span class="time">{{.Time}}</span>{{if .Edited}}<span class="time">(edited)</span>{{end}}
+<div class="content">{{.Message.Content}}</div>
+{{range .Files}}<div class="attachment"><a href="{{.}}">{{.}}</a></div>
+{{end}}</div>
+`))
+
+type htmlWriter struct{}
+
+func (htmlWriter) header(w io.Writer, channel string) error {
+	return htmlHeader.Execute(w, channel)
+}
+
+func (htmlWriter) entry(w io.Writer, e *Entry) error {
+	return htmlEntry.Execute(w, map[string]any{
+		"Message": e.Message,
+		"Author":  e.author(),
+		"Time":    e.time().UTC().Format(time.RFC3339),
+		"Edited":  !e.Message.Edited.IsZero(),
+		"Files":   e.Files,
+	})
+}
+
+func (htmlWriter) footer(w io.Writer) error {
+	_, err := io.WriteString(w, "</body>\n</html>\n")
+	return err
+}
+
+type textWriter struct{}
+
+func (textWriter) header(w io.Writer, channel string) error {
+	_, err := fmt.Fprintf(w, "Transcript of %s\n\n", channel)
+	return err
+}
+
+func (textWriter) entry(w io.Writer, e *Entry) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "[%s] %s: %s", e.time().UTC().Format("2006-01-02 15:04:05"), e.author(), e.Message.Content)
+
+	if !e.Message.Edited.IsZero() {
+		b.WriteString(" (edited)")
+	}
+
+	b.WriteString("\n")
+
+	for _, f := range e.Files {
+		fmt.Fprintf(&b, "    attachment: %s\n", f)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (textWriter) footer(w io.Writer) error {
+	return nil
+}
@@ -3,8 +3,11 @@ package gatewaymiddleware
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/infinitybotlist/grevolt/gateway"
+	"github.com/infinitybotlist/grevolt/gateway/events"
+	"go.uber.org/zap"
 )
 
 // This creates a debug middleware to allow logging of events
@@ -19,3 +22,60 @@ func EventDebug(w *gateway.GatewayClient) {
 		},
 	)
 }
+
+// EventLogger returns a middleware that logs every event along with the time spent
+// in the rest of the middleware chain and the event handler
+func EventLogger(logger *zap.Logger) gateway.Middleware {
+	return func(w *gateway.GatewayClient, ctx *gateway.EventContext, evt events.EventInterface, next func()) {
+		start := time.Now()
+		next()
+		logger.Info(
+			"event handled",
+			zap.String("type", ctx.Type),
+			zap.Int("size", len(ctx.Raw)),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}
+}
+
+// IgnoreAuthors returns a middleware that drops Message events whose author
+// matches the given filter function
+func IgnoreAuthors(filter func(w *gateway.GatewayClient, authorId string) bool) gateway.Middleware {
+	return gateway.TypedMiddleware(func(w *gateway.GatewayClient, ctx *gateway.EventContext, evt *events.Message, next func()) {
+		if evt.Message != nil && filter(w, evt.Author) {
+			return
+		}
+
+		next()
+	})
+}
+
+// IgnoreBots returns a middleware that drops Message events sent by bots
+//
+// This uses the cache to determine whether the author is a bot, messages from
+// uncached users are always dispatched
+func IgnoreBots() gateway.Middleware {
+	return IgnoreAuthors(func(w *gateway.GatewayClient, authorId string) bool {
+		u, err := w.SharedState.GetUser(authorId)
+
+		if err != nil {
+			return false
+		}
+
+		return u.Bot != nil
+	})
+}
+
+// IgnoreUsers returns a middleware that drops Message events sent by the given users
+// (for example, blocked users)
+func IgnoreUsers(ids ...string) gateway.Middleware {
+	ignored := make(map[string]bool, len(ids))
+
+	for _, id := range ids {
+		ignored[id] = true
+	}
+
+	return IgnoreAuthors(func(w *gateway.GatewayClient, authorId string) bool {
+		return ignored[authorId]
+	})
+}
@@ -0,0 +1,76 @@
+package gatewaymiddleware
+
+import (
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/cache/store/basicstore"
+	"github.com/infinitybotlist/grevolt/gateway"
+	"github.com/infinitybotlist/grevolt/gateway/events"
+	"github.com/infinitybotlist/grevolt/types"
+	"go.uber.org/zap"
+)
+
+func newClient(mw gateway.Middleware) *gateway.GatewayClient {
+	w := &gateway.GatewayClient{
+		Encoding: "json",
+		Logger:   zap.NewNop(),
+		SharedState: &state.State{
+			Users: &basicstore.BasicStore[types.User]{},
+		},
+		GatewayCache: gateway.GatewayCacher{
+			Disable: true,
+		},
+	}
+
+	w.SharedState.AddUser(&types.User{Id: "bot", Bot: &types.BotInformation{Owner: "human"}})
+	w.SharedState.AddUser(&types.User{Id: "human"})
+
+	w.Use(mw)
+
+	return w
+}
+
+// Returns whether a message from author reached the event handler
+func dispatched(t *testing.T, w *gateway.GatewayClient, author string) bool {
+	t.Helper()
+
+	payload := `{"type":"Message","_id":"message","channel":"channel","author":"` + author + `","content":"hello"}`
+
+	var handled bool
+	_, err := gateway.CreateEvent[events.Message](w, []byte(payload), func(w *gateway.GatewayClient, ctx *gateway.EventContext, evt *events.Message) {
+		handled = true
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return handled
+}
+
+func TestIgnoreBots(t *testing.T) {
+	w := newClient(IgnoreBots())
+
+	if dispatched(t, w, "bot") {
+		t.Fatal("message from a bot was dispatched")
+	}
+
+	if !dispatched(t, w, "human") {
+		t.Fatal("message from a user was dropped")
+	}
+
+	if !dispatched(t, w, "uncached") {
+		t.Fatal("message from an uncached user was dropped")
+	}
+}
+
+func TestIgnoreUsers(t *testing.T) {
+	w := newClient(IgnoreUsers("blocked", "bot"))
+
+	for author, want := range map[string]bool{"blocked": false, "bot": false, "human": true} {
+		if got := dispatched(t, w, author); got != want {
+			t.Fatalf("message from %s dispatched = %v, want %v", author, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package gatewayprometheus provides a Prometheus collector for gateway metrics
+package gatewayprometheus
+
+import (
+	"time"
+
+	"github.com/infinitybotlist/grevolt/gateway"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector collects gateway metrics and exposes them to Prometheus
+//
+// Collector implements both gateway.GatewayMetrics and prometheus.Collector
+type Collector struct {
+	w *gateway.GatewayClient
+
+	received        *prometheus.CounterVec
+	dispatched      *prometheus.CounterVec
+	failed          *prometheus.CounterVec
+	decodeErrors    prometheus.Counter
+	reconnects      prometheus.Counter
+	handlerDuration *prometheus.HistogramVec
+	state           prometheus.Gauge
+	notifyListeners prometheus.GaugeFunc
+	statusListeners prometheus.GaugeFunc
+}
+
+// New creates a new collector for the given gateway client and sets it as the
+// gateway's metrics hook
+//
+// The collector must still be registered with a prometheus registry
+func New(w *gateway.GatewayClient, namespace string) *Collector {
+	c := &Collector{
+		w: w,
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gateway",
+			Name:      "events_received_total",
+			Help:      "Number of events received from the gateway",
+		}, []string{"type"}),
+		dispatched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gateway",
+			Name:      "events_dispatched_total",
+			Help:      "Number of events dispatched to event handlers",
+		}, []string{"type"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gateway",
+			Name:      "events_failed_total",
+			Help:      "Number of events that failed to be handled",
+		}, []string{"type"}),
+		decodeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gateway",
+			Name:      "decode_errors_total",
+			Help:      "Number of messages that could not be decoded",
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gateway",
+			Name:      "reconnects_total",
+			Help:      "Number of times the gateway has reconnected",
+		}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "gateway",
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent in middlewares and event handlers per event type",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"type"}),
+		state: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "gateway",
+			Name:      "state",
+			Help:      "Current websocket state (0 = closed, 1 = opening, 2 = open, 3 = closing, 4 = restarting)",
+		}),
+	}
+
+	c.notifyListeners = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "notify_listeners",
+		Help:      "Number of listeners on the notify broadcast channel",
+	}, func() float64 {
+		if w.NotifyChannel == nil {
+			return 0
+		}
+
+		return float64(w.NotifyChannel.ListenersCount())
+	})
+
+	c.statusListeners = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "status_listeners",
+		Help:      "Number of listeners on the status broadcast channel",
+	}, func() float64 {
+		if w.StatusChannel == nil {
+			return 0
+		}
+
+		return float64(w.StatusChannel.ListenersCount())
+	})
+
+	c.state.Set(float64(w.State))
+
+	w.Metrics = c
+
+	return c
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.received,
+		c.dispatched,
+		c.failed,
+		c.decodeErrors,
+		c.reconnects,
+		c.handlerDuration,
+		c.state,
+		c.notifyListeners,
+		c.statusListeners,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range c.collectors() {
+		col.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, col := range c.collectors() {
+		col.Collect(ch)
+	}
+}
+
+// EventReceived implements gateway.GatewayMetrics
+func (c *Collector) EventReceived(typ string) {
+	c.received.WithLabelValues(typ).Inc()
+}
+
+// EventDispatched implements gateway.GatewayMetrics
+func (c *Collector) EventDispatched(typ string, duration time.Duration) {
+	c.dispatched.WithLabelValues(typ).Inc()
+	c.handlerDuration.WithLabelValues(typ).Observe(duration.Seconds())
+}
+
+// EventFailed implements gateway.GatewayMetrics
+func (c *Collector) EventFailed(typ string, err error) {
+	c.failed.WithLabelValues(typ).Inc()
+}
+
+// DecodeError implements gateway.GatewayMetrics
+func (c *Collector) DecodeError() {
+	c.decodeErrors.Inc()
+}
+
+// Reconnect implements gateway.GatewayMetrics
+func (c *Collector) Reconnect() {
+	c.reconnects.Inc()
+}
+
+// StateChanged implements gateway.GatewayMetrics
+func (c *Collector) StateChanged(state gateway.WsState) {
+	c.state.Set(float64(state))
+}
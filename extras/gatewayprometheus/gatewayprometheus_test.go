@@ -0,0 +1,80 @@
+package gatewayprometheus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/gateway"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestCollector(t *testing.T) {
+	w := &gateway.GatewayClient{Logger: zap.NewNop()}
+	c := New(w, "test")
+
+	if w.Metrics != c {
+		t.Fatal("collector not set as the gateway's metrics hook")
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.EventReceived("Message")
+	c.EventReceived("Message")
+	c.EventDispatched("Message", 20*time.Millisecond)
+	c.EventFailed("Message", errors.New("failed"))
+	c.DecodeError()
+	c.Reconnect()
+	c.StateChanged(gateway.WsStateOpen)
+
+	expected := `
+# HELP test_gateway_events_received_total Number of events received from the gateway
+# TYPE test_gateway_events_received_total counter
+test_gateway_events_received_total{type="Message"} 2
+# HELP test_gateway_events_dispatched_total Number of events dispatched to event handlers
+# TYPE test_gateway_events_dispatched_total counter
+test_gateway_events_dispatched_total{type="Message"} 1
+# HELP test_gateway_events_failed_total Number of events that failed to be handled
+# TYPE test_gateway_events_failed_total counter
+test_gateway_events_failed_total{type="Message"} 1
+# HELP test_gateway_decode_errors_total Number of messages that could not be decoded
+# TYPE test_gateway_decode_errors_total counter
+test_gateway_decode_errors_total 1
+# HELP test_gateway_reconnects_total Number of times the gateway has reconnected
+# TYPE test_gateway_reconnects_total counter
+test_gateway_reconnects_total 1
+# HELP test_gateway_state Current websocket state (0 = closed, 1 = opening, 2 = open, 3 = closing, 4 = restarting)
+# TYPE test_gateway_state gauge
+test_gateway_state 2
+# HELP test_gateway_notify_listeners Number of listeners on the notify broadcast channel
+# TYPE test_gateway_notify_listeners gauge
+test_gateway_notify_listeners 0
+`
+
+	err := testutil.GatherAndCompare(
+		reg,
+		strings.NewReader(expected),
+		"test_gateway_events_received_total",
+		"test_gateway_events_dispatched_total",
+		"test_gateway_events_failed_total",
+		"test_gateway_decode_errors_total",
+		"test_gateway_reconnects_total",
+		"test_gateway_state",
+		"test_gateway_notify_listeners",
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(c, "test_gateway_handler_duration_seconds"); n != 1 {
+		t.Fatalf("got %d handler duration series, want 1", n)
+	}
+}
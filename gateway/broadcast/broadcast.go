@@ -1,116 +1,273 @@
 // Idea from: https://betterprogramming.pub/how-to-broadcast-messages-in-go-using-channels-b68f42bdf32e
 //
-// With grevolt-specific changes
+// With grevolt-specific changes, subscriptions are buffered and a slow subscriber
+// is handled according to its overflow policy instead of blocking every other
+// subscriber
 package broadcast
 
 import (
-	"context"
+	"sync"
 
 	"go.uber.org/zap"
 )
 
+// The default buffer size of a subscription
+const DefaultBufferSize = 16
+
+// OverflowPolicy controls what happens when a subscription's buffer is full
+type OverflowPolicy int
+
+const (
+	// Block the broadcaster until the subscriber has room in its buffer, the
+	// subscription is cancelled or the server is closed
+	OverflowBlock OverflowPolicy = iota
+
+	// Drop the oldest value in the subscriber's buffer to make room for the new one
+	OverflowDropOldest
+
+	// Drop the new value, keeping the subscriber's buffer as is
+	OverflowDropNewest
+
+	// Cancel the subscription, closing its channel
+	OverflowDisconnect
+)
+
+type subscription[T any] struct {
+	// Held for reading while sending and for writing while closing ch
+	sendMu sync.RWMutex
+
+	// Serializes drops for OverflowDropOldest
+	dropMu sync.Mutex
+
+	ch     chan T
+	policy OverflowPolicy
+	closed bool
+
+	// Closed when the subscription is cancelled to unblock any pending sends
+	cancelled chan struct{}
+	once      sync.Once
+}
+
+// Closes the subscription, unblocking any pending sends first
+func (sub *subscription[T]) close() {
+	sub.once.Do(func() {
+		close(sub.cancelled)
+	})
+
+	sub.sendMu.Lock()
+	defer sub.sendMu.Unlock()
+
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+}
+
 type BroadcastServer[T any] struct {
 	// The logger to use
 	Logger *zap.Logger
 
-	// The source channel
-	Source chan T
+	// Buffer size of new subscriptions created using Subscribe()
+	BufferSize int
+
+	// Overflow policy of new subscriptions created using Subscribe()
+	Policy OverflowPolicy
+
+	mu        sync.RWMutex
+	open      bool
+	listeners map[<-chan T]*subscription[T]
+	closed    chan struct{}
+}
+
+// NewBroadcastServer creates a new broadcast server with the default buffer
+// size and a blocking overflow policy
+func NewBroadcastServer[T any](logger *zap.Logger) *BroadcastServer[T] {
+	return &BroadcastServer[T]{
+		Logger:     logger,
+		BufferSize: DefaultBufferSize,
+		Policy:     OverflowBlock,
+		open:       true,
+		listeners:  make(map[<-chan T]*subscription[T]),
+		closed:     make(chan struct{}),
+	}
+}
 
-	// Whether the broadcast server is open or not
-	Open bool
+// IsOpen returns whether the broadcast server is open or not
+func (s *BroadcastServer[T]) IsOpen() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	listeners      []chan T
-	addListener    chan chan T
-	removeListener chan (<-chan T)
-	context        context.Context
-	cancel         context.CancelFunc
+	return s.open
 }
 
 // ListenersCount returns the number of listeners
 func (s *BroadcastServer[T]) ListenersCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return len(s.listeners)
 }
 
+// Broadcast sends a value to all subscribers
+//
+// Broadcasting on a closed server is a no-op
 func (s *BroadcastServer[T]) Broadcast(val T) {
-	s.Source <- val
+	s.mu.RLock()
+
+	if !s.open {
+		s.mu.RUnlock()
+		s.Logger.Debug("Broadcast server: broadcast after close, ignoring")
+		return
+	}
+
+	subs := make([]*subscription[T], 0, len(s.listeners))
+	for _, sub := range s.listeners {
+		subs = append(subs, sub)
+	}
+
+	s.mu.RUnlock()
+
+	for _, sub := range subs {
+		if !s.send(sub, val) {
+			s.Logger.Debug("Broadcast server: disconnecting slow listener")
+			s.CancelSubscription(sub.ch)
+		}
+	}
 }
 
+// Sends a value to a subscriber according to its overflow policy
+//
+// Returns false if the subscriber should be disconnected
+func (s *BroadcastServer[T]) send(sub *subscription[T], val T) bool {
+	sub.sendMu.RLock()
+	defer sub.sendMu.RUnlock()
+
+	if sub.closed {
+		return true
+	}
+
+	// Fast path, there is room in the buffer
+	select {
+	case sub.ch <- val:
+		return true
+	case <-sub.cancelled:
+		return true
+	default:
+	}
+
+	switch sub.policy {
+	case OverflowDropNewest:
+		return true
+	case OverflowDisconnect:
+		return false
+	case OverflowDropOldest:
+		// Nothing to drop on an unbuffered subscription
+		if cap(sub.ch) == 0 {
+			return true
+		}
+
+		sub.dropMu.Lock()
+		defer sub.dropMu.Unlock()
+
+		for {
+			select {
+			case sub.ch <- val:
+				return true
+			default:
+			}
+
+			// Drop the oldest value, the subscriber may have received it in the meantime
+			select {
+			case <-sub.ch:
+			default:
+			}
+		}
+	default:
+		select {
+		case sub.ch <- val:
+		case <-sub.cancelled:
+		case <-s.closed:
+		}
+
+		return true
+	}
+}
+
+// Close closes the broadcast server, all subscriptions are closed
 func (s *BroadcastServer[T]) Close() {
-	s.Open = false
-	s.cancel()
+	s.mu.Lock()
+
+	if !s.open {
+		s.mu.Unlock()
+		return
+	}
+
+	s.Logger.Debug("Broadcast server: shutting down")
+
+	s.open = false
+	close(s.closed)
+
+	subs := s.listeners
+	s.listeners = make(map[<-chan T]*subscription[T])
+
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
 }
 
 // Subscribe returns a new channel that will receive all broadcasts
+//
+// The subscription uses the servers BufferSize and Policy
 func (s *BroadcastServer[T]) Subscribe() <-chan T {
-	newListener := make(chan T)
-	s.addListener <- newListener
-	return newListener
+	return s.SubscribeWith(s.BufferSize, s.Policy)
 }
 
-// CancelSubscription cancels a subscription
+// SubscribeWith returns a new channel that will receive all broadcasts
+// with the given buffer size and overflow policy
 //
-// All channels returned by Subscribe() should be cancelled eventually
-func (s *BroadcastServer[T]) CancelSubscription(channel <-chan T) {
-	s.removeListener <- channel
-}
+// If the server is closed, the returned channel is closed
+func (s *BroadcastServer[T]) SubscribeWith(bufferSize int, policy OverflowPolicy) <-chan T {
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+
+	sub := &subscription[T]{
+		ch:        make(chan T, bufferSize),
+		policy:    policy,
+		cancelled: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-func NewBroadcastServer[T any](logger *zap.Logger) BroadcastServer[T] {
-	ctx, cancel := context.WithCancel(context.Background())
-	service := BroadcastServer[T]{
-		Source:         make(chan T),
-		Logger:         logger,
-		context:        ctx,
-		cancel:         cancel,
-		listeners:      make([]chan T, 0),
-		addListener:    make(chan chan T),
-		removeListener: make(chan (<-chan T)),
-		Open:           true,
+	if !s.open {
+		sub.closed = true
+		close(sub.ch)
+		return sub.ch
 	}
-	go service.serve()
-	return service
+
+	s.Logger.Debug("Broadcast server: new listener add")
+	s.listeners[sub.ch] = sub
+
+	return sub.ch
 }
 
-func (s *BroadcastServer[T]) serve() {
-	defer func() {
-		for _, listener := range s.listeners {
-			if listener != nil {
-				close(listener)
-			}
-		}
-	}()
+// CancelSubscription cancels a subscription, closing its channel
+//
+// All channels returned by Subscribe() should be cancelled eventually, cancelling
+// a subscription more than once or after the server is closed is a no-op
+func (s *BroadcastServer[T]) CancelSubscription(channel <-chan T) {
+	s.mu.Lock()
+	sub, ok := s.listeners[channel]
+	delete(s.listeners, channel)
+	s.mu.Unlock()
 
-	for {
-		select {
-		case <-s.context.Done():
-			s.Logger.Debug("Broadcast server: shutting down")
-			return
-		case newListener := <-s.addListener:
-			s.Logger.Debug("Broadcast server: new listener add")
-			s.listeners = append(s.listeners, newListener)
-		case listenerToRemove := <-s.removeListener:
-			s.Logger.Debug("Broadcast server: listener remove")
-			for i, ch := range s.listeners {
-				if ch == listenerToRemove {
-					s.listeners[i] = s.listeners[len(s.listeners)-1]
-					s.listeners = s.listeners[:len(s.listeners)-1]
-					close(ch)
-					break
-				}
-			}
-		case val, ok := <-s.Source:
-			if !ok {
-				return
-			}
-			for _, listener := range s.listeners {
-				if listener != nil {
-					select {
-					case listener <- val:
-					case <-s.context.Done():
-						return
-					}
-
-				}
-			}
-		}
+	if !ok {
+		return
 	}
+
+	s.Logger.Debug("Broadcast server: listener remove")
+	sub.close()
 }
@@ -0,0 +1,223 @@
+package broadcast
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newServer() *BroadcastServer[int] {
+	return NewBroadcastServer[int](zap.NewNop())
+}
+
+// Receives n values from ch, failing the test on timeout
+func recvN(t *testing.T, ch <-chan int, n int) []int {
+	t.Helper()
+
+	var vals []int
+	for i := 0; i < n; i++ {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				t.Fatalf("channel closed after %d values", len(vals))
+			}
+			vals = append(vals, v)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d values", len(vals))
+		}
+	}
+
+	return vals
+}
+
+func TestBroadcastAllListeners(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	a := s.Subscribe()
+	b := s.Subscribe()
+
+	if s.ListenersCount() != 2 {
+		t.Fatalf("expected 2 listeners, got %d", s.ListenersCount())
+	}
+
+	for i := 0; i < 3; i++ {
+		s.Broadcast(i)
+	}
+
+	for _, ch := range []<-chan int{a, b} {
+		vals := recvN(t, ch, 3)
+
+		for i, v := range vals {
+			if v != i {
+				t.Fatalf("expected %d, got %d", i, v)
+			}
+		}
+	}
+}
+
+func TestSlowListenerDoesNotBlock(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropOldest, OverflowDropNewest, OverflowDisconnect} {
+		s := newServer()
+
+		slow := s.SubscribeWith(1, policy)
+		fast := s.SubscribeWith(10, OverflowBlock)
+
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 10; i++ {
+				s.Broadcast(i)
+			}
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("policy %d: broadcast blocked on slow listener", policy)
+		}
+
+		if vals := recvN(t, fast, 10); vals[9] != 9 {
+			t.Fatalf("policy %d: fast listener got %v", policy, vals)
+		}
+
+		switch policy {
+		case OverflowDropOldest:
+			if v := recvN(t, slow, 1)[0]; v != 9 {
+				t.Fatalf("drop oldest: expected newest value 9, got %d", v)
+			}
+		case OverflowDropNewest:
+			if v := recvN(t, slow, 1)[0]; v != 0 {
+				t.Fatalf("drop newest: expected oldest value 0, got %d", v)
+			}
+		case OverflowDisconnect:
+			// The buffered value is still readable, then the channel is closed
+			recvN(t, slow, 1)
+
+			if _, ok := <-slow; ok {
+				t.Fatal("disconnect: expected channel to be closed")
+			}
+
+			if s.ListenersCount() != 1 {
+				t.Fatalf("disconnect: expected 1 listener, got %d", s.ListenersCount())
+			}
+		}
+
+		s.Close()
+	}
+}
+
+func TestBlockingListenerUnblockedByCancel(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	ch := s.SubscribeWith(0, OverflowBlock)
+
+	done := make(chan struct{})
+	go func() {
+		s.Broadcast(1)
+		close(done)
+	}()
+
+	// Give the broadcaster time to block
+	time.Sleep(10 * time.Millisecond)
+	s.CancelSubscription(ch)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast still blocked after cancelling subscription")
+	}
+
+	// Cancelling twice is a no-op
+	s.CancelSubscription(ch)
+}
+
+func TestBroadcastAfterClose(t *testing.T) {
+	s := newServer()
+	ch := s.Subscribe()
+
+	s.Close()
+
+	if s.IsOpen() {
+		t.Fatal("server should be closed")
+	}
+
+	if _, ok := <-ch; ok {
+		t.Fatal("expected subscription to be closed")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Broadcast(1)
+		s.CancelSubscription(ch)
+		s.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast after close blocked")
+	}
+
+	if _, ok := <-s.Subscribe(); ok {
+		t.Fatal("subscribing to a closed server should return a closed channel")
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	s := newServer()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ch := s.SubscribeWith(i%3, OverflowPolicy(i%4))
+
+			for j := 0; j < 50; j++ {
+				select {
+				case <-ch:
+				default:
+				}
+			}
+
+			s.CancelSubscription(ch)
+		}(i)
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				s.Broadcast(j)
+			}
+		}()
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		s.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock in concurrent use")
+	}
+
+	s.Close()
+}
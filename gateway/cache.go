@@ -2,11 +2,13 @@ package gateway
 
 import (
 	"errors"
+	"time"
 
 	"github.com/infinitybotlist/grevolt/cache/diff"
 	"github.com/infinitybotlist/grevolt/cache/store"
 	"github.com/infinitybotlist/grevolt/gateway/events"
 	"github.com/infinitybotlist/grevolt/types"
+	"github.com/infinitybotlist/grevolt/types/timestamp"
 	"go.uber.org/zap"
 )
 
@@ -52,6 +54,15 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 				return err
 			}
 		}
+
+		// Cache all emojis
+		for _, emoji := range evt.Emojis {
+			err := w.SharedState.AddEmoji(emoji)
+
+			if err != nil {
+				return err
+			}
+		}
 	case "ChannelCreate":
 		evt := d.(*events.ChannelCreate)
 
@@ -71,17 +82,21 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 		if errors.Is(err, store.ErrNotFound) {
 			w.Logger.Debug("Channel not found in cache, caching as partial", zap.String("channel", evt.Id))
 			// Cache the channel
-			err := w.SharedState.AddChannel(evt.Data)
+			partial := diff.Patch(nil, evt.Data, evt.Fields, evt.Clear)
+			partial.Id = evt.Id
+			err := w.SharedState.AddChannel(partial)
 
 			if err != nil {
 				return err
 			}
+
+			return nil
 		} else if err != nil {
 			return err
 		}
 
 		// Update the channel
-		newChan := diff.PartialUpdate[types.Channel](c, evt.Data)
+		newChan := diff.Patch(c, evt.Data, evt.Fields, evt.Clear)
 
 		w.Logger.Debug("Updated channel", zap.Any("now", newChan), zap.Any("patch", evt.Data))
 
@@ -93,8 +108,8 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 	case "ChannelDelete":
 		evt := d.(*events.ChannelDelete)
 
-		// Delete the channel from cache
-		err := w.SharedState.DeleteChannel(evt.Id)
+		// Delete the channel from cache and its server
+		err := w.SharedState.RemoveChannel(evt.Id)
 
 		if err != nil {
 			return err
@@ -129,6 +144,20 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 				}
 			}
 		}
+
+		// Cache all emojis
+		for _, emoji := range evt.Emojis {
+			err := w.SharedState.AddEmoji(emoji)
+
+			if err != nil {
+				w.Logger.Error(
+					"Failed to cache emoji",
+					zap.Error(err),
+					zap.String("type", typ),
+					zap.String("emoji", emoji.Id),
+				)
+			}
+		}
 	case "ServerUpdate":
 		evt := d.(*events.ServerUpdate)
 
@@ -139,19 +168,23 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 		if errors.Is(err, store.ErrNotFound) {
 			w.Logger.Debug("Server not found in cache, caching as partial", zap.String("server", evt.Id))
 			// Cache the server
-			err := w.SharedState.AddServer(evt.Data)
+			partial := diff.Patch(nil, evt.Data, evt.Fields, evt.Clear)
+			partial.Id = evt.Id
+			err := w.SharedState.AddServer(partial)
 
 			if err != nil {
 				return err
 			}
+
+			return nil
 		} else if err != nil {
 			return err
 		}
 
 		// Update the server
-		newServ := diff.PartialUpdate[types.Server](s, evt.Data)
+		newServ := diff.Patch(s, evt.Data, evt.Fields, evt.Clear)
 
-		w.Logger.Debug("Updated channel", zap.Any("now", newServ), zap.Any("patch", evt.Data))
+		w.Logger.Debug("Updated server", zap.Any("now", newServ), zap.Any("patch", evt.Data))
 
 		err = w.SharedState.AddServer(newServ)
 
@@ -161,8 +194,8 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 	case "ServerDelete":
 		evt := d.(*events.ServerDelete)
 
-		// Delete the server from cache
-		err := w.SharedState.DeleteServer(evt.Id)
+		// Delete the server along with its channels and members from cache
+		err := w.SharedState.PurgeServer(evt.Id)
 
 		if err != nil {
 			return err
@@ -177,8 +210,9 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 		if errors.Is(err, store.ErrNotFound) {
 			w.Logger.Debug("Member not found in cache, caching as partial", zap.String("server", evt.Id.Server), zap.String("member", evt.Id.User))
 			// Cache the member
-			evt.Data.Id = evt.Id
-			err := w.SharedState.AddMember(evt.Data)
+			partial := diff.Patch(nil, evt.Data, evt.Fields, evt.Clear)
+			partial.Id = evt.Id
+			err := w.SharedState.AddMember(partial)
 
 			if err != nil {
 				return err
@@ -190,7 +224,7 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 		}
 
 		// Update the member
-		newMember := diff.PartialUpdate[types.Member](m, evt.Data)
+		newMember := diff.Patch(m, evt.Data, evt.Fields, evt.Clear)
 
 		w.Logger.Debug("Updated member", zap.Any("now", newMember), zap.Any("patch", evt.Data))
 
@@ -224,7 +258,7 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 		}
 
 		// Update the user
-		newUser := diff.PartialUpdate[types.User](u, evt.Data)
+		newUser := diff.Patch(u, evt.Data, evt.Fields, evt.Clear)
 
 		w.Logger.Debug("Updated user [UserUpdate]", zap.Any("now", newUser), zap.Any("patch", evt.Data))
 
@@ -279,6 +313,8 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 			if err != nil {
 				return err
 			}
+
+			return nil
 		} else if err != nil {
 			return err
 		}
@@ -299,6 +335,270 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 		// Delete the emoji from cache
 		err := w.SharedState.DeleteEmoji(evt.Id)
 
+		if err != nil {
+			return err
+		}
+	case "ServerMemberJoin":
+		evt := d.(*events.ServerMemberJoin)
+
+		// Members may already be cached from a fetch
+		_, err := w.SharedState.GetMember(evt.Id, evt.UserId)
+
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+
+		// Cache the member
+		err = w.SharedState.AddMember(&types.Member{
+			Id:       &types.MemberId{Server: evt.Id, User: evt.UserId},
+			JoinedAt: timestamp.Timestamp{Time: time.Now()},
+		})
+
+		if err != nil {
+			return err
+		}
+	case "ServerMemberLeave":
+		evt := d.(*events.ServerMemberLeave)
+
+		// Delete the member from cache
+		err := w.SharedState.DeleteMember(evt.Id, evt.UserId)
+
+		if err != nil {
+			return err
+		}
+	case "ServerRoleUpdate":
+		evt := d.(*events.ServerRoleUpdate)
+
+		if evt.Data == nil {
+			return nil
+		}
+
+		s, err := w.SharedState.GetServer(evt.Id)
+
+		if errors.Is(err, store.ErrNotFound) {
+			w.Logger.Debug("Server not found in cache, ignoring role update", zap.String("server", evt.Id), zap.String("role", evt.RoleId))
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// New roles are cached as partial, existing roles are updated
+		newRole := evt.Data
+
+		if r, ok := s.Roles[evt.RoleId]; ok && r != nil {
+			newRole = diff.Patch(r, evt.Data, evt.Fields, evt.Clear)
+		}
+
+		w.Logger.Debug("Updated role", zap.Any("now", newRole), zap.Any("patch", evt.Data))
+
+		err = w.SharedState.SetRole(evt.Id, evt.RoleId, newRole)
+
+		if err != nil {
+			return err
+		}
+	case "ServerRoleDelete":
+		evt := d.(*events.ServerRoleDelete)
+
+		// Remove the role from its server and members
+		err := w.SharedState.RemoveRole(evt.Id, evt.RoleId)
+
+		if err != nil {
+			return err
+		}
+	case "ChannelGroupJoin":
+		evt := d.(*events.ChannelGroupJoin)
+
+		err := w.SharedState.AddRecipient(evt.Id, evt.UserId)
+
+		if err != nil {
+			return err
+		}
+	case "ChannelGroupLeave":
+		evt := d.(*events.ChannelGroupLeave)
+
+		err := w.SharedState.RemoveRecipient(evt.Id, evt.UserId)
+
+		if err != nil {
+			return err
+		}
+	case "UserPlatformWipe":
+		evt := d.(*events.UserPlatformWipe)
+
+		// Purge the user along with their members and messages
+		err := w.SharedState.PurgeUser(evt.UserId)
+
+		if err != nil {
+			return err
+		}
+	case "Message":
+		evt := d.(*events.Message)
+
+		// Update the last message of the channel
+		c, err := w.SharedState.GetChannel(evt.Channel)
+
+		if err == nil {
+			newChan := *c
+			newChan.LastMessageID = evt.Id
+
+			err = w.SharedState.AddChannel(&newChan)
+
+			if err != nil {
+				return err
+			}
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+
+		if w.SharedState.Messages == nil {
+			return nil
+		}
+
+		// Cache the message
+		err = w.SharedState.AddMessage(evt.Message)
+
+		if err != nil {
+			return err
+		}
+	case "MessageUpdate":
+		evt := d.(*events.MessageUpdate)
+
+		if evt.Data == nil {
+			return nil
+		}
+
+		return w.updateMessage(evt.Id, func(m *types.Message) {
+			diff.PartialUpdate[types.Message](m, evt.Data)
+		})
+	case "MessageAppend":
+		evt := d.(*events.MessageAppend)
+
+		if evt.Append == nil {
+			return nil
+		}
+
+		return w.updateMessage(evt.Id, func(m *types.Message) {
+			m.Embeds = append(append([]*types.MessageEmbed{}, m.Embeds...), evt.Append.Embeds...)
+		})
+	case "MessageDelete":
+		evt := d.(*events.MessageDelete)
+
+		if w.SharedState.Messages == nil {
+			return nil
+		}
+
+		for _, id := range append([]string{evt.Id}, evt.Ids...) {
+			if id == "" {
+				continue
+			}
+
+			err := w.SharedState.DeleteMessage(id)
+
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		}
+	case "MessageReact":
+		evt := d.(*events.MessageReact)
+
+		return w.updateMessage(evt.Id, func(m *types.Message) {
+			m.Reactions = copyReactions(m.Reactions)
+
+			for _, u := range m.Reactions[evt.EmojiId] {
+				if u == evt.UserId {
+					return
+				}
+			}
+
+			m.Reactions[evt.EmojiId] = append(m.Reactions[evt.EmojiId], evt.UserId)
+		})
+	case "MessageUnreact":
+		evt := d.(*events.MessageUnreact)
+
+		return w.updateMessage(evt.Id, func(m *types.Message) {
+			m.Reactions = copyReactions(m.Reactions)
+
+			var users []string
+			for _, u := range m.Reactions[evt.EmojiId] {
+				if u != evt.UserId {
+					users = append(users, u)
+				}
+			}
+
+			if len(users) == 0 {
+				delete(m.Reactions, evt.EmojiId)
+			} else {
+				m.Reactions[evt.EmojiId] = users
+			}
+		})
+	case "MessageRemoveReaction":
+		evt := d.(*events.MessageRemoveReaction)
+
+		return w.updateMessage(evt.Id, func(m *types.Message) {
+			m.Reactions = copyReactions(m.Reactions)
+			delete(m.Reactions, evt.EmojiId)
+		})
+	case "WebhookCreate":
+		evt := d.(*events.WebhookCreate)
+
+		if w.SharedState.Webhooks == nil {
+			return nil
+		}
+
+		// Cache the webhook
+		err := w.SharedState.AddWebhook(evt.Webhook)
+
+		if err != nil {
+			return err
+		}
+	case "WebhookUpdate":
+		evt := d.(*events.WebhookUpdate)
+
+		if w.SharedState.Webhooks == nil {
+			return nil
+		}
+
+		// Look for the webhook in cache
+		wh, err := w.SharedState.GetWebhook(evt.Id)
+
+		// Cache webhook as partial if not found
+		if errors.Is(err, store.ErrNotFound) {
+			w.Logger.Debug("Webhook not found in cache, caching as partial", zap.String("webhook", evt.Id))
+			// Cache the webhook
+			partial := diff.Patch(nil, evt.Data, evt.Fields, evt.Clear)
+			partial.Id = evt.Id
+			err := w.SharedState.AddWebhook(partial)
+
+			if err != nil {
+				return err
+			}
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// Update the webhook
+		newWebhook := diff.Patch(wh, evt.Data, evt.Fields, evt.Clear)
+
+		w.Logger.Debug("Updated webhook", zap.Any("now", newWebhook), zap.Any("patch", evt.Data))
+
+		err = w.SharedState.AddWebhook(newWebhook)
+
+		if err != nil {
+			return err
+		}
+	case "WebhookDelete":
+		evt := d.(*events.WebhookDelete)
+
+		if w.SharedState.Webhooks == nil {
+			return nil
+		}
+
+		// Delete the webhook from cache
+		err := w.SharedState.DeleteWebhook(evt.Id)
+
 		if err != nil {
 			return err
 		}
@@ -306,3 +606,51 @@ func (w *GatewayClient) CacheEvent(d events.EventInterface) error {
 
 	return nil
 }
+
+// Returns whether events of the type are cached synchronously before being dispatched
+// instead of in the background afterwards
+//
+// This allows handlers of MessageUpdate and MessageDelete to use
+// State.GetMessageRevision and State.GetDeletedMessage
+func cachedBeforeDispatch(typ string) bool {
+	switch typ {
+	case "Message", "MessageUpdate", "MessageAppend", "MessageDelete", "MessageReact", "MessageUnreact", "MessageRemoveReaction":
+		return true
+	default:
+		return false
+	}
+}
+
+// Applies fn to a copy of a cached message, messages that are not cached are ignored
+// as message updates are not enough to be a starting point for a message
+func (w *GatewayClient) updateMessage(id string, fn func(m *types.Message)) error {
+	if w.SharedState.Messages == nil {
+		return nil
+	}
+
+	m, err := w.SharedState.GetMessage(id)
+
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	newMsg := *m
+	fn(&newMsg)
+
+	w.Logger.Debug("Updated message", zap.Any("now", &newMsg))
+
+	return w.SharedState.AddMessage(&newMsg)
+}
+
+// Returns a copy of the reactions of a message that is safe to modify
+func copyReactions(r map[string][]string) map[string][]string {
+	res := make(map[string][]string, len(r)+1)
+
+	for k, v := range r {
+		res[k] = append([]string{}, v...)
+	}
+
+	return res
+}
@@ -0,0 +1,652 @@
+package gateway
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/cache/store/basicstore"
+	"github.com/infinitybotlist/grevolt/cache/store/messagestore"
+	"github.com/infinitybotlist/grevolt/gateway/events"
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+)
+
+// Ids used in the recorded payloads in testdata/events
+const (
+	testServer  = "01F7ZSBSFHQ8TA81725KQCSDDP"
+	testChannel = "01F7ZSBSFHCAAJQ92ZGTY67HMN"
+	testVoice   = "01F92C5ZXBQWQ8KY7J8KY917NM"
+	testGroup   = "01FGC6N58Z6RSW3TBZ6NEQBKRW"
+	testOwner   = "01EX2NCWQ0CHS3QJF0FEQS1GR4"
+	testUser    = "01FEEFJCKY5C4DMMJYZ20ACWWC"
+	testJoiner  = "01H2P3QWM4VYGTQ2ZDS0Y3WQJT"
+	testRole    = "01FBCN8HKJAQX1NZJ4SC3QZ46R"
+	testEmoji   = "01GX773A8JPQ0VP64NWGEBMQ1E"
+	testMessage = "01H2P2C3XWPTN4N1ENNMVPHPMJ"
+	testWebhook = "01H2P5A2WB8J0H0M1ZQ0F7M9E4"
+)
+
+// Returns a gateway client whose state is populated from the recorded Ready event
+func cacheClient(t *testing.T) *GatewayClient {
+	t.Helper()
+
+	w := &GatewayClient{
+		Encoding: "json",
+		Logger:   zap.NewNop(),
+		SharedState: &state.State{
+			Users:    &basicstore.BasicStore[types.User]{},
+			Servers:  &basicstore.BasicStore[types.Server]{},
+			Channels: &basicstore.BasicStore[types.Channel]{},
+			Members:  &basicstore.BasicStore[types.Member]{},
+			Emojis:   &basicstore.BasicStore[types.Emoji]{},
+			Messages: &basicstore.BasicStore[types.Message]{},
+			Webhooks: &basicstore.BasicStore[types.Webhook]{},
+		},
+		GatewayCache: GatewayCacher{
+			DisableAutoRestFetching: true,
+		},
+	}
+
+	cacheRecorded(t, w, "Ready")
+
+	return w
+}
+
+// Decodes a recorded event payload and caches it
+//
+// Payloads are named after their event type, optionally followed by a dot and a variant
+func cacheRecorded(t *testing.T, w *GatewayClient, name string) {
+	t.Helper()
+
+	payload, err := os.ReadFile(filepath.Join("testdata", "events", name+".json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	typ, _, _ := strings.Cut(name, ".")
+
+	if w.Encoding == "msgpack" {
+		payload = toMsgpack(t, payload)
+	}
+
+	evt, err := w.EventHandlers.Handle(w, payload, typ)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if evt == nil {
+		t.Fatalf("event %s was not decoded", typ)
+	}
+
+	// Message events are already cached when they are dispatched
+	if cachedBeforeDispatch(typ) {
+		return
+	}
+
+	if err := w.CacheEvent(evt); err != nil {
+		t.Fatalf("failed to cache %s: %s", typ, err)
+	}
+}
+
+// Re-encodes a JSON payload as msgpack
+func toMsgpack(t *testing.T, payload []byte) []byte {
+	t.Helper()
+
+	var v map[string]any
+
+	if err := json.Unmarshal(payload, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := msgpack.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestCacheReady(t *testing.T) {
+	s := cacheClient(t).SharedState
+
+	if s.Users.Length() != 2 || s.Servers.Length() != 1 || s.Channels.Length() != 3 || s.Members.Length() != 2 {
+		t.Fatal("ready was not fully cached")
+	}
+
+	if _, err := s.GetEmoji(testEmoji); err != nil {
+		t.Fatal("ready emojis were not cached")
+	}
+}
+
+func TestCacheMessage(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "Message")
+
+	m, err := w.SharedState.GetMessage(testMessage)
+
+	if err != nil || m.Content != "hello world" {
+		t.Fatal("message was not cached")
+	}
+
+	if c, _ := w.SharedState.GetChannel(testChannel); c.LastMessageID != testMessage {
+		t.Fatalf("last message of channel was not updated: %s", c.LastMessageID)
+	}
+
+	// Without a message store only the channel is updated
+	w = cacheClient(t)
+	w.SharedState.Messages = nil
+	cacheRecorded(t, w, "Message")
+}
+
+func TestCacheMessageUpdate(t *testing.T) {
+	w := cacheClient(t)
+
+	// Updates to uncached messages are ignored
+	cacheRecorded(t, w, "MessageUpdate")
+
+	if _, err := w.SharedState.GetMessage(testMessage); err == nil {
+		t.Fatal("partial message was cached")
+	}
+
+	cacheRecorded(t, w, "Message")
+	cacheRecorded(t, w, "MessageUpdate")
+
+	m, _ := w.SharedState.GetMessage(testMessage)
+
+	if m.Content != "hello revolt" || m.Edited.IsZero() || m.Author != testUser {
+		t.Fatalf("message was not updated: %+v", m)
+	}
+}
+
+func TestCacheMessageAppend(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "Message")
+	cacheRecorded(t, w, "MessageAppend")
+
+	if m, _ := w.SharedState.GetMessage(testMessage); len(m.Embeds) != 1 || m.Embeds[0].Url != "https://revolt.chat" {
+		t.Fatal("embeds were not appended")
+	}
+}
+
+func TestCacheMessageDelete(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "Message")
+	cacheRecorded(t, w, "MessageDelete")
+
+	if _, err := w.SharedState.GetMessage(testMessage); err == nil {
+		t.Fatal("message was not deleted")
+	}
+}
+
+func TestCacheMessageReact(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "Message")
+
+	before, _ := w.SharedState.GetMessage(testMessage)
+
+	cacheRecorded(t, w, "MessageReact")
+	cacheRecorded(t, w, "MessageReact")
+
+	m, _ := w.SharedState.GetMessage(testMessage)
+
+	if r := m.Reactions[testEmoji]; len(r) != 2 || r[1] != testUser {
+		t.Fatalf("reaction was not added: %v", r)
+	}
+
+	if len(before.Reactions[testEmoji]) != 1 {
+		t.Fatal("previously cached message was modified in place")
+	}
+}
+
+func TestCacheMessageUnreact(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "Message")
+	cacheRecorded(t, w, "MessageUnreact")
+
+	if m, _ := w.SharedState.GetMessage(testMessage); len(m.Reactions) != 0 {
+		t.Fatalf("reaction was not removed: %v", m.Reactions)
+	}
+}
+
+func TestCacheMessageRemoveReaction(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "Message")
+	cacheRecorded(t, w, "MessageReact")
+	cacheRecorded(t, w, "MessageRemoveReaction")
+
+	if m, _ := w.SharedState.GetMessage(testMessage); len(m.Reactions) != 0 {
+		t.Fatalf("reactions were not removed: %v", m.Reactions)
+	}
+}
+
+func TestCacheChannelCreate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ChannelCreate")
+
+	if c, err := w.SharedState.GetChannel("01H2P35BSCAGXG4Y0BE8DBHZ4B"); err != nil || c.Name != "off-topic" {
+		t.Fatal("channel was not cached")
+	}
+}
+
+func TestCacheChannelUpdate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ChannelUpdate")
+
+	c, _ := w.SharedState.GetChannel(testChannel)
+
+	if c.Name != "general" || c.Description != "Talk about anything" || c.Server != testServer {
+		t.Fatalf("channel was not updated: %+v", c)
+	}
+
+	// Uncached channels are cached as partial
+	w.SharedState.DeleteChannel(testChannel)
+	cacheRecorded(t, w, "ChannelUpdate")
+
+	if c, err := w.SharedState.GetChannel(testChannel); err != nil || c.Name != "general" {
+		t.Fatal("partial channel was not cached")
+	}
+}
+
+func TestCacheChannelDelete(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ChannelDelete")
+
+	if _, err := w.SharedState.GetChannel(testVoice); err == nil {
+		t.Fatal("channel was not deleted")
+	}
+
+	if se, _ := w.SharedState.GetServer(testServer); len(se.Channels) != 1 || se.Channels[0] != testChannel {
+		t.Fatalf("channel was not removed from its server: %v", se.Channels)
+	}
+}
+
+func TestCacheChannelGroupJoin(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ChannelGroupJoin")
+	cacheRecorded(t, w, "ChannelGroupJoin")
+
+	if c, _ := w.SharedState.GetChannel(testGroup); len(c.Recipients) != 3 || c.Recipients[2] != testJoiner {
+		t.Fatalf("recipient was not added: %v", c.Recipients)
+	}
+}
+
+func TestCacheChannelGroupLeave(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ChannelGroupLeave")
+
+	if c, _ := w.SharedState.GetChannel(testGroup); len(c.Recipients) != 1 || c.Recipients[0] != testOwner {
+		t.Fatalf("recipient was not removed: %v", c.Recipients)
+	}
+}
+
+func TestCacheServerCreate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerCreate")
+
+	if _, err := w.SharedState.GetServer("01H2P40C4QX2A7B4N7W0KM4X9E"); err != nil {
+		t.Fatal("server was not cached")
+	}
+
+	if _, err := w.SharedState.GetChannel("01H2P40C4Q9AZ6Y1PZ2V1B0KRS"); err != nil {
+		t.Fatal("server channels were not cached")
+	}
+
+	if _, err := w.SharedState.GetEmoji("01H2P40C4RWMH0A7GR3X1JB7QK"); err != nil {
+		t.Fatal("server emojis were not cached")
+	}
+}
+
+func TestCacheServerUpdate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerUpdate")
+
+	se, _ := w.SharedState.GetServer(testServer)
+
+	if se.Name != "Revolt Lounge" || se.Description != "The official server" || len(se.Roles) != 1 {
+		t.Fatalf("server was not updated: %+v", se)
+	}
+
+	// Uncached servers are cached as partial
+	w.SharedState.DeleteServer(testServer)
+	cacheRecorded(t, w, "ServerUpdate")
+
+	if se, err := w.SharedState.GetServer(testServer); err != nil || se.Name != "Revolt Lounge" {
+		t.Fatal("partial server was not cached")
+	}
+}
+
+func TestCacheServerDelete(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerDelete")
+
+	s := w.SharedState
+
+	if _, err := s.GetServer(testServer); err == nil {
+		t.Fatal("server was not deleted")
+	}
+
+	if _, err := s.GetChannel(testChannel); err == nil {
+		t.Fatal("server channels were not deleted")
+	}
+
+	if _, err := s.GetMember(testServer, testUser); err == nil {
+		t.Fatal("server members were not deleted")
+	}
+
+	if _, err := s.GetChannel(testGroup); err != nil {
+		t.Fatal("unrelated channel was deleted")
+	}
+}
+
+func TestCacheServerMemberUpdate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerMemberUpdate")
+
+	if m, _ := w.SharedState.GetMember(testServer, testUser); m.Nickname != "lexisother" || m.JoinedAt.IsZero() {
+		t.Fatalf("member was not updated: %+v", m)
+	}
+}
+
+func TestCacheServerMemberJoin(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerMemberJoin")
+
+	m, err := w.SharedState.GetMember(testServer, testJoiner)
+
+	if err != nil || m.JoinedAt.IsZero() {
+		t.Fatal("member was not cached")
+	}
+
+	members, _ := w.SharedState.GetServerMembers(testServer)
+
+	if len(members) != 3 {
+		t.Fatalf("expected 3 members, got %d", len(members))
+	}
+}
+
+func TestCacheServerMemberLeave(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerMemberLeave")
+
+	if _, err := w.SharedState.GetMember(testServer, testUser); err == nil {
+		t.Fatal("member was not deleted")
+	}
+}
+
+func TestCacheServerRoleUpdate(t *testing.T) {
+	w := cacheClient(t)
+
+	before, _ := w.SharedState.GetServer(testServer)
+
+	cacheRecorded(t, w, "ServerRoleUpdate")
+
+	se, _ := w.SharedState.GetServer(testServer)
+	r := se.Roles[testRole]
+
+	if r == nil || r.Name != "Mod" || r.Rank != 2 || r.Colour != "#e74c3c" || !r.Hoist {
+		t.Fatalf("role was not updated: %+v", r)
+	}
+
+	if before.Roles[testRole].Name != "Moderator" {
+		t.Fatal("previously cached role was modified in place")
+	}
+
+	// New roles are added to the server
+	se.Roles = nil
+	w.SharedState.AddServer(se)
+	cacheRecorded(t, w, "ServerRoleUpdate")
+
+	if se, _ := w.SharedState.GetServer(testServer); se.Roles[testRole] == nil || se.Roles[testRole].Name != "Mod" {
+		t.Fatal("new role was not added")
+	}
+}
+
+func TestCacheServerRoleDelete(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerRoleDelete")
+
+	if se, _ := w.SharedState.GetServer(testServer); len(se.Roles) != 0 {
+		t.Fatalf("role was not deleted: %v", se.Roles)
+	}
+
+	if m, _ := w.SharedState.GetMember(testServer, testOwner); len(m.Roles) != 0 {
+		t.Fatalf("role was not removed from member: %v", m.Roles)
+	}
+}
+
+func TestCacheUserUpdate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "UserUpdate")
+
+	u, _ := w.SharedState.GetUser(testUser)
+
+	if u.Status == nil || u.Status.Text != "coding" || u.Username != "lexisother" {
+		t.Fatalf("user was not updated: %+v", u)
+	}
+}
+
+func TestCacheUserRelationship(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "UserRelationship")
+
+	if u, _ := w.SharedState.GetUser(testUser); u.Relationship != "Blocked" {
+		t.Fatalf("relationship was not updated: %s", u.Relationship)
+	}
+}
+
+func TestCacheUserPlatformWipe(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "Message")
+	cacheRecorded(t, w, "UserPlatformWipe")
+
+	s := w.SharedState
+
+	if _, err := s.GetUser(testUser); err == nil {
+		t.Fatal("user was not purged")
+	}
+
+	if _, err := s.GetMember(testServer, testUser); err == nil {
+		t.Fatal("members of user were not purged")
+	}
+
+	if _, err := s.GetMessage(testMessage); err == nil {
+		t.Fatal("messages of user were not purged")
+	}
+
+	if _, err := s.GetUser(testOwner); err != nil {
+		t.Fatal("unrelated user was purged")
+	}
+}
+
+func TestCacheEmojiCreate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "EmojiCreate")
+
+	if e, err := w.SharedState.GetEmoji("01H2P4S8C6Y0ZBQ1X3C9Q1H4PB"); err != nil || e.Name != "yeah" {
+		t.Fatal("emoji was not cached")
+	}
+}
+
+func TestCacheEmojiDelete(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "EmojiDelete")
+
+	if _, err := w.SharedState.GetEmoji(testEmoji); err == nil {
+		t.Fatal("emoji was not deleted")
+	}
+}
+
+func TestCacheWebhookCreate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "WebhookCreate")
+
+	if wh, err := w.SharedState.GetWebhook(testWebhook); err != nil || wh.Name != "GitHub" {
+		t.Fatal("webhook was not cached")
+	}
+
+	// Without a webhook store webhooks are ignored
+	w = cacheClient(t)
+	w.SharedState.Webhooks = nil
+	cacheRecorded(t, w, "WebhookCreate")
+}
+
+func TestCacheWebhookUpdate(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "WebhookCreate")
+	cacheRecorded(t, w, "WebhookUpdate")
+
+	wh, _ := w.SharedState.GetWebhook(testWebhook)
+
+	if wh.Name != "GitHub Releases" || wh.ChannelId != testChannel {
+		t.Fatalf("webhook was not updated: %+v", wh)
+	}
+}
+
+func TestCacheWebhookDelete(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "WebhookCreate")
+	cacheRecorded(t, w, "WebhookDelete")
+
+	if _, err := w.SharedState.GetWebhook(testWebhook); err == nil {
+		t.Fatal("webhook was not deleted")
+	}
+}
+
+func TestCacheChannelUpdateClear(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ChannelUpdate.clear")
+
+	c, _ := w.SharedState.GetChannel(testChannel)
+
+	if c.Description != "" || c.Icon != nil || c.NSFW || c.Name != "General" {
+		t.Fatalf("channel fields were not cleared: %+v", c)
+	}
+}
+
+func TestCacheServerUpdateClear(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerUpdate.clear")
+
+	se, _ := w.SharedState.GetServer(testServer)
+
+	if se.Description != "" || se.Banner != nil || se.Discoverable || se.Analytics || se.Name != "Revolt" {
+		t.Fatalf("server fields were not cleared: %+v", se)
+	}
+}
+
+func TestCacheServerMemberUpdateClear(t *testing.T) {
+	for _, encoding := range []string{"json", "msgpack"} {
+		w := cacheClient(t)
+		w.Encoding = encoding
+		cacheRecorded(t, w, "ServerMemberUpdate.clear")
+
+		m, _ := w.SharedState.GetMember(testServer, testUser)
+
+		if m.Nickname != "" || m.Avatar != nil || m.JoinedAt.IsZero() {
+			t.Fatalf("member fields were not cleared [%s]: %+v", encoding, m)
+		}
+	}
+}
+
+func TestCacheServerRoleUpdateClear(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "ServerRoleUpdate.clear")
+
+	se, _ := w.SharedState.GetServer(testServer)
+	r := se.Roles[testRole]
+
+	if r.Colour != "" || r.Hoist || r.Name != "Moderator" || r.Rank != 1 {
+		t.Fatalf("role fields were not cleared: %+v", r)
+	}
+}
+
+func TestCacheUserUpdateClear(t *testing.T) {
+	w := cacheClient(t)
+
+	before, _ := w.SharedState.GetUser(testUser)
+
+	cacheRecorded(t, w, "UserUpdate.clear")
+
+	u, _ := w.SharedState.GetUser(testUser)
+
+	if u.Status.Text != "" || u.Status.Presence != "Online" || u.Profile.Content != "" || u.Profile.Background == nil {
+		t.Fatalf("nested user fields were not cleared: %+v %+v", u.Status, u.Profile)
+	}
+
+	if u.DisplayName != "" || u.Online || u.Username != "lexisother" {
+		t.Fatalf("user fields were not cleared: %+v", u)
+	}
+
+	if before.Status.Text != "vibing" || before.Profile.Content != "hi" {
+		t.Fatal("previously cached user was modified in place")
+	}
+}
+
+func TestCacheWebhookUpdateClear(t *testing.T) {
+	w := cacheClient(t)
+	cacheRecorded(t, w, "WebhookCreate")
+	cacheRecorded(t, w, "WebhookUpdate.clear")
+
+	wh, _ := w.SharedState.GetWebhook(testWebhook)
+
+	if wh.Avatar != nil || wh.Name != "GitHub" {
+		t.Fatalf("webhook fields were not cleared: %+v", wh)
+	}
+}
+
+func TestMessageHistoryInHandlers(t *testing.T) {
+	w := cacheClient(t)
+	w.SharedState.Messages = &messagestore.MessageStore{}
+
+	var before, after, deleted *types.Message
+
+	w.EventHandlers.MessageUpdate = func(w *GatewayClient, ctx *EventContext, evt *events.MessageUpdate) {
+		before, after, _ = w.SharedState.GetMessageRevision(evt.Id)
+	}
+
+	w.EventHandlers.MessageDelete = func(w *GatewayClient, ctx *EventContext, evt *events.MessageDelete) {
+		deleted, _ = w.SharedState.GetDeletedMessage(evt.Id)
+	}
+
+	cacheRecorded(t, w, "Message")
+	cacheRecorded(t, w, "MessageUpdate")
+
+	if before == nil || after == nil || before.Content != "hello world" || after.Content != "hello revolt" {
+		t.Fatalf("unexpected edit %+v -> %+v", before, after)
+	}
+
+	cacheRecorded(t, w, "MessageDelete")
+
+	if deleted == nil || deleted.Content != "hello revolt" {
+		t.Fatalf("unexpected deleted message %+v", deleted)
+	}
+}
+
+func TestMessageHistoryAfterReactAndWipe(t *testing.T) {
+	w := cacheClient(t)
+	w.SharedState.Messages = &messagestore.MessageStore{}
+
+	cacheRecorded(t, w, "Message")
+	cacheRecorded(t, w, "MessageUpdate")
+	cacheRecorded(t, w, "MessageReact")
+
+	// Reacting is not an edit, the content before the edit is kept
+	if before, _, _ := w.SharedState.GetMessageRevision(testMessage); before == nil || before.Content != "hello world" {
+		t.Fatalf("revision was replaced by a reaction: %+v", before)
+	}
+
+	cacheRecorded(t, w, "MessageDelete")
+	cacheRecorded(t, w, "UserPlatformWipe")
+
+	if _, err := w.SharedState.GetDeletedMessage(testMessage); err == nil {
+		t.Fatal("deleted message of wiped user is still readable")
+	}
+}
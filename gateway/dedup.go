@@ -0,0 +1,171 @@
+package gateway
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key fields used to de-duplicate events
+type dedupData struct {
+	EntityId string `json:"_id"`
+	Id       string `json:"id"`
+	UserId   string `json:"user"`
+}
+
+// DefaultDedupKey returns the de-duplication key for an event, or an empty
+// string if the event should never be de-duplicated
+//
+// Only events which create or remove an entity are de-duplicated, updates
+// may legitimately be sent multiple times with the same IDs
+func DefaultDedupKey(w *GatewayClient, event []byte, typ string) string {
+	switch typ {
+	case "Message", "ChannelCreate", "EmojiCreate":
+		var d dedupData
+		if err := w.Decode(event, &d); err != nil || d.EntityId == "" {
+			return ""
+		}
+
+		return typ + ":" + d.EntityId
+	case "MessageDelete", "ChannelDelete", "ServerDelete", "EmojiDelete", "WebhookCreate", "WebhookDelete":
+		var d dedupData
+		if err := w.Decode(event, &d); err != nil || d.Id == "" {
+			return ""
+		}
+
+		return typ + ":" + d.Id
+	case "ServerMemberJoin", "ServerMemberLeave", "ChannelGroupJoin", "ChannelGroupLeave":
+		var d dedupData
+		if err := w.Decode(event, &d); err != nil || d.Id == "" || d.UserId == "" {
+			return ""
+		}
+
+		// A user may leave and rejoin within the window, see dedupOpposites
+		return typ + ":" + d.Id + "/" + d.UserId
+	}
+
+	return ""
+}
+
+// Events which undo each other, seeing one forgets the other so a user leaving and
+// rejoining within the window is not dropped as a duplicate
+//
+// This applies to keys of the form "type:..." as returned by DefaultDedupKey
+var dedupOpposites = map[string]string{
+	"ServerMemberJoin":  "ServerMemberLeave",
+	"ServerMemberLeave": "ServerMemberJoin",
+	"ChannelGroupJoin":  "ChannelGroupLeave",
+	"ChannelGroupLeave": "ChannelGroupJoin",
+}
+
+type dedupEntry struct {
+	key string
+	at  time.Time
+}
+
+// EventDeduplicator suppresses events that have already been seen within a time window
+//
+// This is useful as reconnects and overlapping Bulk payloads may cause the
+// same event to be sent more than once
+type EventDeduplicator struct {
+	sync.Mutex
+
+	// How long an event is remembered for
+	Window time.Duration
+
+	// Maximum number of events to remember, oldest events are forgotten first
+	//
+	// 0 means no limit (other than Window)
+	MaxEntries int
+
+	// Function to get the de-duplication key of an event, defaults to DefaultDedupKey
+	//
+	// An empty key means the event will not be de-duplicated
+	KeyFunc func(w *GatewayClient, event []byte, typ string) string
+
+	seen    map[string]time.Time
+	entries []dedupEntry
+}
+
+// NewEventDeduplicator creates a new deduplicator with the given window and max entries
+func NewEventDeduplicator(window time.Duration, maxEntries int) *EventDeduplicator {
+	return &EventDeduplicator{
+		Window:     window,
+		MaxEntries: maxEntries,
+		KeyFunc:    DefaultDedupKey,
+	}
+}
+
+// IsDuplicate returns whether the event has already been seen within the window,
+// marking it as seen if not
+func (d *EventDeduplicator) IsDuplicate(w *GatewayClient, event []byte, typ string) bool {
+	keyFunc := d.KeyFunc
+
+	if keyFunc == nil {
+		keyFunc = DefaultDedupKey
+	}
+
+	key := keyFunc(w, event, typ)
+
+	if key == "" {
+		return false
+	}
+
+	return d.seenKey(key, time.Now())
+}
+
+func (d *EventDeduplicator) seenKey(key string, now time.Time) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.seen == nil {
+		d.seen = make(map[string]time.Time)
+	}
+
+	// Forget expired entries, entries are in insertion order so the oldest ones are first
+	var expired int
+	for expired < len(d.entries) && now.Sub(d.entries[expired].at) >= d.Window {
+		expired++
+	}
+
+	d.forget(expired)
+
+	if at, ok := d.seen[key]; ok && now.Sub(at) < d.Window {
+		return true
+	}
+
+	// Make room for the new entry
+	if d.MaxEntries > 0 && len(d.entries) >= d.MaxEntries {
+		d.forget(len(d.entries) - d.MaxEntries + 1)
+	}
+
+	d.seen[key] = now
+	d.entries = append(d.entries, dedupEntry{key: key, at: now})
+
+	if typ, rest, ok := strings.Cut(key, ":"); ok {
+		if opposite, ok := dedupOpposites[typ]; ok {
+			// Its entry is skipped when it expires as the seen time no longer matches
+			delete(d.seen, opposite+":"+rest)
+		}
+	}
+
+	return false
+}
+
+// Forgets the n oldest entries
+//
+// Must be called with the lock held
+func (d *EventDeduplicator) forget(n int) {
+	if n <= 0 {
+		return
+	}
+
+	for _, e := range d.entries[:n] {
+		// The key may have been seen again since, in which case keep the newer one
+		if d.seen[e.key].Equal(e.at) {
+			delete(d.seen, e.key)
+		}
+	}
+
+	d.entries = append(d.entries[:0], d.entries[n:]...)
+}
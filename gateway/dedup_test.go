@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/gateway/events"
+)
+
+func TestDefaultDedupKey(t *testing.T) {
+	w := dispatchClient()
+
+	tests := map[string]struct {
+		typ     string
+		payload string
+		key     string
+	}{
+		"message":       {"Message", testMessagePayload, "Message:message"},
+		"delete":        {"MessageDelete", `{"type":"MessageDelete","id":"message","channel":"channel"}`, "MessageDelete:message"},
+		"join":          {"ServerMemberJoin", `{"type":"ServerMemberJoin","id":"server","user":"user"}`, "ServerMemberJoin:server/user"},
+		"update":        {"MessageUpdate", `{"type":"MessageUpdate","id":"message","channel":"channel","data":{}}`, ""},
+		"missing id":    {"Message", `{"type":"Message"}`, ""},
+		"invalid":       {"Message", `not json`, ""},
+		"missing user":  {"ServerMemberLeave", `{"type":"ServerMemberLeave","id":"server"}`, ""},
+		"unknown event": {"Authenticated", `{"type":"Authenticated"}`, ""},
+	}
+
+	for name, tt := range tests {
+		if key := DefaultDedupKey(w, []byte(tt.payload), tt.typ); key != tt.key {
+			t.Errorf("%s: got key %q, want %q", name, key, tt.key)
+		}
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	d := NewEventDeduplicator(time.Minute, 0)
+	start := time.Now()
+
+	if d.seenKey("Message:a", start) {
+		t.Fatal("first event reported as duplicate")
+	}
+
+	if !d.seenKey("Message:a", start.Add(30*time.Second)) {
+		t.Fatal("event within the window not reported as duplicate")
+	}
+
+	if d.seenKey("Message:a", start.Add(time.Minute)) {
+		t.Fatal("event after the window reported as duplicate")
+	}
+
+	// The window starts again from the last time the event was accepted
+	if !d.seenKey("Message:a", start.Add(90*time.Second)) {
+		t.Fatal("event within the new window not reported as duplicate")
+	}
+
+	// Expired entries are forgotten
+	d.seenKey("Message:b", start.Add(5*time.Minute))
+
+	if len(d.seen) != 1 || len(d.entries) != 1 {
+		t.Fatalf("got %d seen keys and %d entries after expiry, want 1 and 1", len(d.seen), len(d.entries))
+	}
+}
+
+func TestDedupMaxEntries(t *testing.T) {
+	d := NewEventDeduplicator(time.Hour, 2)
+	now := time.Now()
+
+	for _, key := range []string{"Message:a", "Message:b", "Message:c"} {
+		if d.seenKey(key, now) {
+			t.Fatalf("%s reported as duplicate", key)
+		}
+	}
+
+	if len(d.entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(d.entries))
+	}
+
+	// a was evicted to make room for c, the most recent events are remembered
+	if d.seenKey("Message:a", now) {
+		t.Fatal("evicted event reported as duplicate")
+	}
+
+	if !d.seenKey("Message:c", now) {
+		t.Fatal("remembered event not reported as duplicate")
+	}
+}
+
+func TestDedupRejoin(t *testing.T) {
+	w := dispatchClient()
+	w.Deduplicator = NewEventDeduplicator(time.Minute, 0)
+
+	var joins, leaves int
+	w.EventHandlers.ServerMemberJoin = func(w *GatewayClient, ctx *EventContext, evt *events.ServerMemberJoin) {
+		joins++
+	}
+	w.EventHandlers.ServerMemberLeave = func(w *GatewayClient, ctx *EventContext, evt *events.ServerMemberLeave) {
+		leaves++
+	}
+
+	join := []byte(`{"type":"ServerMemberJoin","id":"server","user":"user"}`)
+	leave := []byte(`{"type":"ServerMemberLeave","id":"server","user":"user"}`)
+
+	w.HandleEvent(join, "ServerMemberJoin")
+	w.HandleEvent(join, "ServerMemberJoin") // Duplicate
+	w.HandleEvent(leave, "ServerMemberLeave")
+	w.HandleEvent(join, "ServerMemberJoin") // Rejoin within the window
+	w.HandleEvent(leave, "ServerMemberLeave")
+
+	if joins != 2 || leaves != 2 {
+		t.Fatalf("got %d joins and %d leaves, want 2 and 2", joins, leaves)
+	}
+}
+
+func TestDedupOverlappingBulk(t *testing.T) {
+	w := dispatchClient()
+	w.Deduplicator = NewEventDeduplicator(time.Minute, 0)
+
+	var ids []string
+	w.EventHandlers.Message = func(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+		ids = append(ids, evt.Id)
+	}
+
+	bulk := func(ids ...string) []byte {
+		payload := `{"type":"Bulk","v":[`
+		for i, id := range ids {
+			if i > 0 {
+				payload += ","
+			}
+
+			payload += `{"type":"Message","_id":"` + id + `","channel":"channel","author":"author","content":"hello"}`
+		}
+
+		return []byte(payload + "]}")
+	}
+
+	w.HandleEvent(bulk("a", "b"), "Bulk")
+	w.HandleEvent(bulk("b", "c"), "Bulk")
+
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "b" || ids[2] != "c" {
+		t.Fatalf("got messages %v, want [a b c]", ids)
+	}
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"errors"
+	"time"
 
 	"github.com/infinitybotlist/grevolt/gateway/events"
 	"go.uber.org/zap"
@@ -10,12 +11,19 @@ import (
 type EventContext struct {
 	// Raw event data
 	Raw []byte
+
+	// The event type
+	Type string
 }
 
 type Event[T events.EventInterface] func(w *GatewayClient, ctx *EventContext, evt *T)
 
 // Emits an event to a function
 //
+// The event is passed through the middleware chain before being dispatched,
+// panics in the middlewares or event handler are recovered and reported to
+// the error sink (OnHandlerError)
+//
 // +unstable
 func CreateEvent[T events.EventInterface](
 	w *GatewayClient,
@@ -27,16 +35,51 @@ func CreateEvent[T events.EventInterface](
 	err := w.Decode(data, &evtMarshalled)
 
 	if err != nil {
+		w.metrics().DecodeError()
 		return nil, errors.New("decode error: " + err.Error())
 	}
 
-	if fn == nil {
-		return evtMarshalled, nil
+	if evtMarshalled == nil {
+		w.metrics().DecodeError()
+		return nil, errors.New("decode error: event is null")
+	}
+
+	ctx := &EventContext{
+		Raw:  data,
+		Type: (*evtMarshalled).EventType(),
+	}
+
+	// Message events are cached before being dispatched so handlers can look up the
+	// previous content of edited and deleted messages
+	if cachedBeforeDispatch(ctx.Type) && !w.GatewayCache.Disable {
+		err := w.CacheEvent(any(evtMarshalled).(events.EventInterface))
+
+		if err != nil {
+			w.Logger.Error(
+				"Failed to cache event",
+				zap.Error(err),
+				zap.String("type", ctx.Type),
+			)
+		}
 	}
 
-	fn(w, &EventContext{
-		Raw: data,
-	}, evtMarshalled)
+	start := time.Now()
+
+	// Stays false if a middleware dropped the event or a panic was recovered (which
+	// is reported through EventFailed instead)
+	var dispatched bool
+
+	w.safeDispatch(ctx, func() {
+		dispatched = w.runMiddlewares(ctx, any(evtMarshalled).(events.EventInterface), func() {
+			if fn != nil {
+				fn(w, ctx, evtMarshalled)
+			}
+		})
+	})
+
+	if dispatched {
+		w.metrics().EventDispatched(ctx.Type, time.Since(start))
+	}
 
 	return evtMarshalled, nil
 }
@@ -108,9 +151,23 @@ func (w *GatewayClient) HandleAuth(event []byte) error {
 }
 
 func (w *GatewayClient) HandleEvent(event []byte, typ string) {
+	if w.Deduplicator != nil && w.Deduplicator.IsDuplicate(w, event, typ) {
+		w.Logger.Debug("Ignoring duplicate event", zap.String("type", typ))
+		return
+	}
+
+	w.metrics().EventReceived(typ)
+
 	if w.RawSinkFunc != nil && len(w.RawSinkFunc) > 0 {
+		ctx := &EventContext{
+			Raw:  event,
+			Type: typ,
+		}
+
 		for _, fn := range w.RawSinkFunc {
-			fn(w, event, typ)
+			w.safeDispatch(ctx, func() {
+				fn(w, event, typ)
+			})
 		}
 	}
 
@@ -136,6 +193,7 @@ func (w *GatewayClient) HandleEvent(event []byte, typ string) {
 	evt, err := w.EventHandlers.Handle(w, event, typ)
 
 	if err != nil {
+		w.metrics().EventFailed(typ, err)
 		w.Logger.Error(
 			"Event handling failed",
 			zap.Error(err),
@@ -145,7 +203,7 @@ func (w *GatewayClient) HandleEvent(event []byte, typ string) {
 	}
 
 	// Handle caching here
-	if evt != nil && !w.GatewayCache.Disable {
+	if evt != nil && !w.GatewayCache.Disable && !cachedBeforeDispatch(typ) {
 		go func() {
 			err := w.CacheEvent(evt)
 
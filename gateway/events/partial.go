@@ -0,0 +1,112 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Decodes an update event into v (an alias of the event type to avoid recursion),
+// returning the keys present in its data object
+//
+// Partial objects can't tell an unset field apart from a field set to its zero value,
+// the keys are used to apply zero values as well (see diff.Patch)
+func decodePartial(b []byte, v any, unmarshal func([]byte, any) error) ([]string, error) {
+	if err := unmarshal(b, v); err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		Data map[string]any `json:"data"`
+	}
+
+	if err := unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(raw.Data))
+	for k := range raw.Data {
+		fields = append(fields, k)
+	}
+
+	return fields, nil
+}
+
+func unmarshalMsgpack(b []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func (e *ChannelUpdate) UnmarshalJSON(b []byte) (err error) {
+	type alias ChannelUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), json.Unmarshal)
+	return err
+}
+
+func (e *ChannelUpdate) UnmarshalMsgpack(b []byte) (err error) {
+	type alias ChannelUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), unmarshalMsgpack)
+	return err
+}
+
+func (e *ServerUpdate) UnmarshalJSON(b []byte) (err error) {
+	type alias ServerUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), json.Unmarshal)
+	return err
+}
+
+func (e *ServerUpdate) UnmarshalMsgpack(b []byte) (err error) {
+	type alias ServerUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), unmarshalMsgpack)
+	return err
+}
+
+func (e *ServerMemberUpdate) UnmarshalJSON(b []byte) (err error) {
+	type alias ServerMemberUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), json.Unmarshal)
+	return err
+}
+
+func (e *ServerMemberUpdate) UnmarshalMsgpack(b []byte) (err error) {
+	type alias ServerMemberUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), unmarshalMsgpack)
+	return err
+}
+
+func (e *ServerRoleUpdate) UnmarshalJSON(b []byte) (err error) {
+	type alias ServerRoleUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), json.Unmarshal)
+	return err
+}
+
+func (e *ServerRoleUpdate) UnmarshalMsgpack(b []byte) (err error) {
+	type alias ServerRoleUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), unmarshalMsgpack)
+	return err
+}
+
+func (e *UserUpdate) UnmarshalJSON(b []byte) (err error) {
+	type alias UserUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), json.Unmarshal)
+	return err
+}
+
+func (e *UserUpdate) UnmarshalMsgpack(b []byte) (err error) {
+	type alias UserUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), unmarshalMsgpack)
+	return err
+}
+
+func (e *WebhookUpdate) UnmarshalJSON(b []byte) (err error) {
+	type alias WebhookUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), json.Unmarshal)
+	return err
+}
+
+func (e *WebhookUpdate) UnmarshalMsgpack(b []byte) (err error) {
+	type alias WebhookUpdate
+	e.Fields, err = decodePartial(b, (*alias)(e), unmarshalMsgpack)
+	return err
+}
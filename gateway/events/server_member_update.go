@@ -21,4 +21,8 @@ type ServerMemberUpdate struct {
 	// This does not affect users, as it expands and not reduces the possible
 	// values.
 	Clear []types.FieldsMember `json:"clear"`
+
+	// JSON keys present in Data, fields listed here are applied even if they are zero
+	// values. This is set when the event is decoded
+	Fields []string `json:"-"`
 }
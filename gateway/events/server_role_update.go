@@ -24,4 +24,8 @@ type ServerRoleUpdate struct {
 	// This does not affect users, as it expands and not reduces the possible
 	// values.
 	Clear []types.FieldsRole `json:"clear"`
+
+	// JSON keys present in Data, fields listed here are applied even if they are zero
+	// values. This is set when the event is decoded
+	Fields []string `json:"-"`
 }
@@ -22,6 +22,10 @@ type UserUpdate struct {
 	// values.
 	Clear []types.FieldsUser `json:"clear"`
 
+	// JSON keys present in Data, fields listed here are applied even if they are zero
+	// values. This is set when the event is decoded
+	Fields []string `json:"-"`
+
 	// <undocumented, may exist???>
 	EventId string `json:"event_id,omitempty"`
 }
@@ -21,4 +21,8 @@ type WebhookUpdate struct {
 	// This does not affect users, as it expands and not reduces the possible
 	// values.
 	Clear []types.FieldsWebhook `json:"clear"`
+
+	// JSON keys present in Data, fields listed here are applied even if they are zero
+	// values. This is set when the event is decoded
+	Fields []string `json:"-"`
 }
@@ -181,15 +181,21 @@ type GatewayClient struct {
 	//
 	// This is very low level and should not be used unless you know what you are doing
 	//
+	// Subscriptions made with Subscribe drop their oldest payloads once their buffer is
+	// full, the gateway's own tasks always receive every payload
+	//
 	// +unstable
-	NotifyChannel broadcast.BroadcastServer[*NotifyPayload]
+	NotifyChannel *broadcast.BroadcastServer[*NotifyPayload]
 
 	// This channel is fired when status updates are received
 	//
 	// This is very low level and should not be used unless you know what you are doing
 	//
+	// Subscriptions made with Subscribe drop their oldest payloads once their buffer is
+	// full, the gateway's own tasks always receive every payload
+	//
 	// +unstable
-	StatusChannel broadcast.BroadcastServer[*StatusPayload]
+	StatusChannel *broadcast.BroadcastServer[*StatusPayload]
 
 	// Websocket state
 	//
@@ -213,6 +219,30 @@ type GatewayClient struct {
 	// by the library
 	RawSinkFunc []func(w *GatewayClient, data []byte, typ string)
 
+	// Middlewares to run on decoded events before they are dispatched to
+	// the event handlers, see Use() and Middleware for more information
+	Middlewares []Middleware
+
+	// Error sink for panics in event handlers and middlewares, defaults to
+	// logging the error (LogHandlerErrors) if unset
+	//
+	// See ChannelHandlerErrorSink for sending errors to a channel
+	OnHandlerError HandlerErrorSink
+
+	// Whether to count handler failures per event type, see HandlerFailures()
+	CountHandlerFailures bool
+
+	handlerFailures handlerFailures
+
+	// Optional de-duplication of events, set this to suppress events sent
+	// more than once (for example, due to reconnects or overlapping Bulk events)
+	//
+	// See NewEventDeduplicator
+	Deduplicator *EventDeduplicator
+
+	// Instrumentation hook for gateway metrics, see GatewayMetrics
+	Metrics GatewayMetrics
+
 	// Whether to disable websocket-based caching
 	//
 	// To be improved
@@ -283,7 +313,7 @@ func (w *GatewayClient) Open() error {
 		return ErrWSAlreadyOpen
 	}
 
-	w.State = WsStateOpening
+	w.setState(WsStateOpening)
 
 	w.Logger.Debug("opening connection to gateway")
 
@@ -296,12 +326,12 @@ func (w *GatewayClient) Open() error {
 	}
 
 	// Reset connection
-	if !w.NotifyChannel.Open {
-		w.NotifyChannel = broadcast.NewBroadcastServer[*NotifyPayload](w.Logger)
+	if w.NotifyChannel == nil || !w.NotifyChannel.IsOpen() {
+		w.NotifyChannel = newGatewayBroadcastServer[*NotifyPayload](w.Logger)
 	}
 
-	if !w.StatusChannel.Open {
-		w.StatusChannel = broadcast.NewBroadcastServer[*StatusPayload](w.Logger)
+	if w.StatusChannel == nil || !w.StatusChannel.IsOpen() {
+		w.StatusChannel = newGatewayBroadcastServer[*StatusPayload](w.Logger)
 	}
 
 	w.WsConn = nil
@@ -334,7 +364,7 @@ func (w *GatewayClient) Open() error {
 	}
 
 	w.WsConn.SetCloseHandler(func(code int, text string) error {
-		w.State = WsStateClosed
+		w.setState(WsStateClosed)
 		w.Logger.Debug("websocket closed: ", zap.Int("code", code), zap.String("closeText", text))
 		w.NotifyChannel.Broadcast(&NotifyPayload{
 			OpCode: ERROR_IOpCode,
@@ -343,7 +373,7 @@ func (w *GatewayClient) Open() error {
 		return nil
 	})
 
-	w.State = WsStateOpen
+	w.setState(WsStateOpen)
 
 	go w.handleNotify()
 	time.Sleep(1 * time.Second)
@@ -355,12 +385,34 @@ func (w *GatewayClient) Open() error {
 }
 
 func (w *GatewayClient) Close() {
-	w.State = WsStateClosing
+	if w.NotifyChannel == nil {
+		return
+	}
+
+	w.setState(WsStateClosing)
 	w.NotifyChannel.Broadcast(&NotifyPayload{
 		OpCode: KILL_IOpCode,
 	})
 }
 
+// Creates a broadcast server for the gateway's notify and status channels
+//
+// A stuck external subscriber (such as a Wait whose caller is busy) must not block
+// readMessages and the heartbeat, so subscriptions made with Subscribe drop their oldest
+// payloads, keeping the most recent ones (such as DONE_StatusMessage) for when it
+// catches up. The gateway's own tasks use subscribeInternal instead.
+func newGatewayBroadcastServer[T any](logger *zap.Logger) *broadcast.BroadcastServer[T] {
+	s := broadcast.NewBroadcastServer[T](logger)
+	s.Policy = broadcast.OverflowDropOldest
+	return s
+}
+
+// Subscribes a task of the gateway itself, such as handleNotify, which must see every
+// payload (events, KILL, RESTART etc.) so broadcasting blocks until it has room
+func subscribeInternal[T any](s *broadcast.BroadcastServer[T]) <-chan T {
+	return s.SubscribeWith(s.BufferSize, broadcast.OverflowBlock)
+}
+
 // Wait for the gateway to close
 func (w *GatewayClient) Wait() {
 	sub := w.StatusChannel.Subscribe()
@@ -388,7 +440,7 @@ type internalMessage struct {
 }
 
 func (w *GatewayClient) readMessages() {
-	sub := w.StatusChannel.Subscribe()
+	sub := subscribeInternal(w.StatusChannel)
 
 	defer func() {
 		w.StatusChannel.CancelSubscription(sub)
@@ -426,6 +478,7 @@ func (w *GatewayClient) readMessages() {
 				err = w.Decode(message, &data)
 
 				if err != nil {
+					w.metrics().DecodeError()
 					w.Logger.Error("failed to unmarshal message: " + err.Error())
 					data = internalMessage{
 						Type: "InternalError",
@@ -541,7 +594,7 @@ func (w *GatewayClient) readMessages() {
 }
 
 func (w *GatewayClient) handleNotify() {
-	sub := w.NotifyChannel.Subscribe()
+	sub := subscribeInternal(w.NotifyChannel)
 
 	defer func() {
 		w.NotifyChannel.CancelSubscription(sub)
@@ -555,6 +608,7 @@ func (w *GatewayClient) handleNotify() {
 		}
 
 		w.Logger.Debug("restarting connection to gateway")
+		w.metrics().Reconnect()
 
 		// Send restart opcode
 		w.Logger.Debug(
@@ -564,7 +618,7 @@ func (w *GatewayClient) handleNotify() {
 
 		w.WsConn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "closeWsConn"), time.Now().Add(w.Deadline))
 		w.WsConn.Close()
-		w.State = WsStateRestarting
+		w.setState(WsStateRestarting)
 
 		w.Logger.Debug("broadcasting WSEND message")
 
@@ -581,7 +635,7 @@ func (w *GatewayClient) handleNotify() {
 	}
 
 	killer := func() {
-		w.State = WsStateClosed
+		w.setState(WsStateClosed)
 		w.WsConn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "closeWsConn"), time.Now().Add(w.Deadline))
 		w.WsConn.Close()
 
@@ -647,7 +701,7 @@ func (w *GatewayClient) StartHeartbeatLoop(dur time.Duration) {
 	ticker := time.NewTicker(w.HeartbeatInterval)
 
 	// Send heartbeat
-	sub := w.StatusChannel.Subscribe()
+	sub := subscribeInternal(w.StatusChannel)
 
 	defer func() {
 		ticker.Stop()
@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/auth"
+	"github.com/infinitybotlist/grevolt/gateway/broadcast"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestStuckSubscriberDoesNotBlockBroadcasts(t *testing.T) {
+	s := newGatewayBroadcastServer[*StatusPayload](zap.NewNop())
+	defer s.Close()
+
+	// Never read from, like a Wait whose caller is busy
+	stuck := s.Subscribe()
+	defer s.CancelSubscription(stuck)
+
+	active := s.Subscribe()
+	defer s.CancelSubscription(active)
+
+	done := make(chan struct{})
+
+	// Broadcast far more payloads than fit in a subscription buffer, as readMessages
+	// and the heartbeat do over the lifetime of a connection
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 1000; i++ {
+			s.Broadcast(&StatusPayload{StatusMessage: WSEND_StatusMessage})
+		}
+
+		s.Broadcast(&StatusPayload{StatusMessage: DONE_StatusMessage})
+	}()
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case p := <-active:
+			if p.StatusMessage == DONE_StatusMessage {
+				select {
+				case <-done:
+				case <-timeout:
+					t.Fatal("broadcasting blocked on the stuck subscriber")
+				}
+
+				// The stuck subscriber still gets the most recent payload once it catches up
+				var last *StatusPayload
+				for len(stuck) > 0 {
+					last = <-stuck
+				}
+
+				if last == nil || last.StatusMessage != DONE_StatusMessage {
+					t.Fatalf("stuck subscriber's last payload is %+v, want DONE", last)
+				}
+
+				return
+			}
+		case <-timeout:
+			t.Fatal("broadcasting blocked on the stuck subscriber")
+		}
+	}
+}
+
+func TestSlowHandleNotifyLosesNoEvents(t *testing.T) {
+	release := make(chan struct{})
+
+	// Blocks handleNotify while it handles AUTHENTICATE, as if w.Send was slow
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(io.Discard), zapcore.DebugLevel)
+	core = zapcore.RegisterHooks(core, func(e zapcore.Entry) error {
+		if e.Message == "sending authenticate command frame" {
+			<-release
+		}
+
+		return nil
+	})
+
+	w := dispatchClient()
+	w.Logger = zap.New(core)
+	w.SessionToken = &auth.Token{}
+	w.NotifyChannel = newGatewayBroadcastServer[*NotifyPayload](w.Logger)
+	defer w.NotifyChannel.Close()
+
+	var received atomic.Int32
+	w.RawSinkFunc = append(w.RawSinkFunc, func(w *GatewayClient, data []byte, typ string) {
+		received.Add(1)
+	})
+
+	go w.handleNotify()
+
+	for w.NotifyChannel.ListenersCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	const count = broadcast.DefaultBufferSize * 4
+
+	// Broadcast like readMessages does, while handleNotify is stuck
+	go func() {
+		w.NotifyChannel.Broadcast(&NotifyPayload{OpCode: AUTHENTICATE_IOpCode})
+
+		for i := 0; i < count; i++ {
+			w.NotifyChannel.Broadcast(&NotifyPayload{
+				OpCode: EVENT_IOpCode,
+				Event:  NotifyEvent{Type: "ChannelStartTyping", Data: []byte(testTypingPayload)},
+			})
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for received.Load() != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d events, want %d", received.Load(), count)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// HandlerError is created when an event handler (or middleware) panics
+//
+// Note that a HandlerError satisfies the error interface
+type HandlerError struct {
+	// The event type
+	Type string
+
+	// Raw event data
+	Raw []byte
+
+	// The value passed to panic()
+	Panic any
+
+	// Stack trace of the panic
+	Stack []byte
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("event handler for %s panicked: %v", e.Type, e.Panic)
+}
+
+// A HandlerErrorSink receives errors from event handlers
+type HandlerErrorSink func(w *GatewayClient, err *HandlerError)
+
+// LogHandlerErrors is a HandlerErrorSink that logs the error using the
+// gateway's logger, this is the default sink
+func LogHandlerErrors(w *GatewayClient, err *HandlerError) {
+	w.Logger.Error(
+		"Event handler panicked",
+		zap.String("type", err.Type),
+		zap.Any("panic", err.Panic),
+		zap.ByteString("raw", err.Raw),
+		zap.ByteString("stack", err.Stack),
+	)
+}
+
+// ChannelHandlerErrorSink returns a HandlerErrorSink that sends errors to the given channel
+//
+// Sends are non-blocking, if the channel is full the error is logged instead
+func ChannelHandlerErrorSink(ch chan<- *HandlerError) HandlerErrorSink {
+	return func(w *GatewayClient, err *HandlerError) {
+		select {
+		case ch <- err:
+		default:
+			LogHandlerErrors(w, err)
+		}
+	}
+}
+
+// Handler failure counter
+type handlerFailures struct {
+	sync.Mutex
+	counts map[string]uint64
+}
+
+// HandlerFailures returns the number of handler failures per event type
+//
+// This is only tracked if CountHandlerFailures is set
+func (w *GatewayClient) HandlerFailures() map[string]uint64 {
+	w.handlerFailures.Lock()
+	defer w.handlerFailures.Unlock()
+
+	counts := make(map[string]uint64, len(w.handlerFailures.counts))
+
+	for k, v := range w.handlerFailures.counts {
+		counts[k] = v
+	}
+
+	return counts
+}
+
+// Runs fn, recovering from any panics and reporting them to the error sink
+func (w *GatewayClient) safeDispatch(ctx *EventContext, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.reportHandlerError(&HandlerError{
+				Type:  ctx.Type,
+				Raw:   ctx.Raw,
+				Panic: r,
+				Stack: debug.Stack(),
+			})
+		}
+	}()
+
+	fn()
+}
+
+func (w *GatewayClient) reportHandlerError(err *HandlerError) {
+	w.metrics().EventFailed(err.Type, err)
+
+	if w.CountHandlerFailures {
+		w.handlerFailures.Lock()
+
+		if w.handlerFailures.counts == nil {
+			w.handlerFailures.counts = make(map[string]uint64)
+		}
+
+		w.handlerFailures.counts[err.Type]++
+		w.handlerFailures.Unlock()
+	}
+
+	if w.OnHandlerError != nil {
+		w.OnHandlerError(w, err)
+		return
+	}
+
+	LogHandlerErrors(w, err)
+}
@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/gateway/events"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func panickingHandler(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+	panic("handler failed")
+}
+
+func TestHandlerPanicRecovered(t *testing.T) {
+	w := dispatchClient()
+
+	var got *HandlerError
+	w.OnHandlerError = func(w *GatewayClient, err *HandlerError) {
+		got = err
+	}
+
+	// A panic must not escape CreateEvent
+	_, err := CreateEvent[events.Message](w, []byte(testMessagePayload), panickingHandler)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got == nil {
+		t.Fatal("panic was not reported")
+	}
+
+	if got.Type != "Message" {
+		t.Errorf("got type %q, want Message", got.Type)
+	}
+
+	if string(got.Raw) != testMessagePayload {
+		t.Errorf("got raw %q, want the event payload", got.Raw)
+	}
+
+	if got.Panic != "handler failed" {
+		t.Errorf("got panic value %v, want handler failed", got.Panic)
+	}
+
+	if !bytes.Contains(got.Stack, []byte("panickingHandler")) {
+		t.Errorf("stack does not contain the panicking handler:\n%s", got.Stack)
+	}
+
+	if got.Error() != "event handler for Message panicked: handler failed" {
+		t.Errorf("unexpected error message %q", got.Error())
+	}
+}
+
+func TestMiddlewarePanicRecovered(t *testing.T) {
+	w := dispatchClient()
+
+	var reported int
+	w.OnHandlerError = func(w *GatewayClient, err *HandlerError) {
+		reported++
+	}
+
+	w.Use(func(w *GatewayClient, ctx *EventContext, evt events.EventInterface, next func()) {
+		panic("middleware failed")
+	})
+
+	var handled bool
+	_, err := CreateEvent[events.Message](w, []byte(testMessagePayload), func(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+		handled = true
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if handled {
+		t.Fatal("event was dispatched after its middleware panicked")
+	}
+
+	if reported != 1 {
+		t.Fatalf("got %d reported errors, want 1", reported)
+	}
+}
+
+func TestChannelHandlerErrorSink(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+
+	w := dispatchClient()
+	w.Logger = zap.New(core)
+
+	ch := make(chan *HandlerError, 1)
+	w.OnHandlerError = ChannelHandlerErrorSink(ch)
+
+	for i := 0; i < 2; i++ {
+		if _, err := CreateEvent[events.Message](w, []byte(testMessagePayload), panickingHandler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(ch) != 1 {
+		t.Fatalf("got %d errors in the channel, want 1", len(ch))
+	}
+
+	// The second error did not fit in the channel and must be logged instead
+	if n := logs.FilterMessage("Event handler panicked").Len(); n != 1 {
+		t.Fatalf("got %d logged errors, want 1", n)
+	}
+
+	if err := <-ch; err.Type != "Message" {
+		t.Fatalf("got error for %q, want Message", err.Type)
+	}
+}
+
+func TestCountHandlerFailures(t *testing.T) {
+	w := dispatchClient()
+	w.OnHandlerError = func(w *GatewayClient, err *HandlerError) {}
+
+	CreateEvent[events.Message](w, []byte(testMessagePayload), panickingHandler)
+
+	if len(w.HandlerFailures()) != 0 {
+		t.Fatal("failures counted without CountHandlerFailures")
+	}
+
+	w.CountHandlerFailures = true
+
+	CreateEvent[events.Message](w, []byte(testMessagePayload), panickingHandler)
+	CreateEvent[events.Message](w, []byte(testMessagePayload), panickingHandler)
+	CreateEvent[events.ChannelStartTyping](w, []byte(testTypingPayload), func(w *GatewayClient, ctx *EventContext, evt *events.ChannelStartTyping) {
+		panic("typing failed")
+	})
+
+	failures := w.HandlerFailures()
+
+	if failures["Message"] != 2 || failures["ChannelStartTyping"] != 1 {
+		t.Fatalf("got failures %v, want Message: 2, ChannelStartTyping: 1", failures)
+	}
+
+	// The returned map is a copy
+	failures["Message"] = 100
+
+	if w.HandlerFailures()["Message"] != 2 {
+		t.Fatal("HandlerFailures returned the internal map")
+	}
+}
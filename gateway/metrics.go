@@ -0,0 +1,56 @@
+package gateway
+
+import "time"
+
+// GatewayMetrics is an instrumentation hook for the gateway, implement this to
+// collect metrics on gateway health and throughput
+//
+// All methods may be called concurrently and should not block.
+//
+// See extras/gatewayprometheus for a Prometheus implementation
+type GatewayMetrics interface {
+	// An event has been received from the websocket
+	EventReceived(typ string)
+
+	// An event has been dispatched to its event handler, duration includes the time
+	// spent in middlewares
+	//
+	// Events dropped by a middleware or whose handler panicked are not reported here
+	EventDispatched(typ string, duration time.Duration)
+
+	// An event failed to be handled (decode error or a panic in the event handler)
+	EventFailed(typ string, err error)
+
+	// A message from the websocket could not be decoded
+	DecodeError()
+
+	// The websocket is reconnecting
+	Reconnect()
+
+	// The websocket state has changed
+	StateChanged(state WsState)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) EventReceived(string)                  {}
+func (noopMetrics) EventDispatched(string, time.Duration) {}
+func (noopMetrics) EventFailed(string, error)             {}
+func (noopMetrics) DecodeError()                          {}
+func (noopMetrics) Reconnect()                            {}
+func (noopMetrics) StateChanged(WsState)                  {}
+
+// Returns the metrics hook to use, this is never nil
+func (w *GatewayClient) metrics() GatewayMetrics {
+	if w.Metrics == nil {
+		return noopMetrics{}
+	}
+
+	return w.Metrics
+}
+
+// Sets the websocket state, reporting it to the metrics hook
+func (w *GatewayClient) setState(state WsState) {
+	w.State = state
+	w.metrics().StateChanged(state)
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/gateway/events"
+)
+
+// Records calls to the metrics hook
+type recordingMetrics struct {
+	sync.Mutex
+	received     map[string]int
+	dispatched   map[string]int
+	failed       map[string]int
+	decodeErrors int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		received:   map[string]int{},
+		dispatched: map[string]int{},
+		failed:     map[string]int{},
+	}
+}
+
+func (m *recordingMetrics) EventReceived(typ string) {
+	m.Lock()
+	defer m.Unlock()
+	m.received[typ]++
+}
+
+func (m *recordingMetrics) EventDispatched(typ string, duration time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.dispatched[typ]++
+}
+
+func (m *recordingMetrics) EventFailed(typ string, err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.failed[typ]++
+}
+
+func (m *recordingMetrics) DecodeError() {
+	m.Lock()
+	defer m.Unlock()
+	m.decodeErrors++
+}
+
+func (m *recordingMetrics) Reconnect()           {}
+func (m *recordingMetrics) StateChanged(WsState) {}
+
+func TestMetrics(t *testing.T) {
+	w := dispatchClient()
+	w.OnHandlerError = func(w *GatewayClient, err *HandlerError) {}
+
+	m := newRecordingMetrics()
+	w.Metrics = m
+
+	var panicNext bool
+	w.EventHandlers.Message = func(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+		if panicNext {
+			panic("handler failed")
+		}
+	}
+
+	// Drops typing events
+	w.Use(TypedMiddleware(func(w *GatewayClient, ctx *EventContext, evt *events.ChannelStartTyping, next func()) {}))
+
+	w.HandleEvent([]byte(testMessagePayload), "Message")
+	w.HandleEvent([]byte(testTypingPayload), "ChannelStartTyping")
+
+	panicNext = true
+	w.HandleEvent([]byte(testMessagePayload), "Message")
+
+	w.HandleEvent([]byte(`{"type":"Message","_id":`), "Message")
+
+	if m.received["Message"] != 3 || m.received["ChannelStartTyping"] != 1 {
+		t.Errorf("got received %v, want Message: 3, ChannelStartTyping: 1", m.received)
+	}
+
+	// Only the first message reached its handler without panicking
+	if m.dispatched["Message"] != 1 || m.dispatched["ChannelStartTyping"] != 0 {
+		t.Errorf("got dispatched %v, want Message: 1", m.dispatched)
+	}
+
+	// The panic and the malformed event
+	if m.failed["Message"] != 2 {
+		t.Errorf("got failed %v, want Message: 2", m.failed)
+	}
+
+	if m.decodeErrors != 1 {
+		t.Errorf("got %d decode errors, want 1", m.decodeErrors)
+	}
+}
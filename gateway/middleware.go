@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"github.com/infinitybotlist/grevolt/gateway/events"
+)
+
+// A middleware intercepts a decoded event before it is dispatched to its event handler
+//
+// Middlewares are run in the order they were added. A middleware must call next to
+// continue the chain, not calling next drops the event (short-circuit) and no later
+// middleware or event handler will see it. Middlewares may also modify the event
+// in-place or delay it by waiting before calling next.
+//
+// Note that dropping an event only prevents it from being dispatched, the event
+// will still be used to update the cache (unless caching is disabled)
+type Middleware func(w *GatewayClient, ctx *EventContext, evt events.EventInterface, next func())
+
+// Use adds middlewares to the end of the middleware chain
+//
+// This should be called before opening the websocket
+func (w *GatewayClient) Use(mw ...Middleware) {
+	w.Middlewares = append(w.Middlewares, mw...)
+}
+
+// TypedMiddleware creates a middleware that only runs for events of type T
+//
+// All other events are passed through to the next middleware unchanged
+func TypedMiddleware[T events.EventInterface](fn func(w *GatewayClient, ctx *EventContext, evt *T, next func())) Middleware {
+	return func(w *GatewayClient, ctx *EventContext, evt events.EventInterface, next func()) {
+		if e, ok := any(evt).(*T); ok {
+			fn(w, ctx, e, next)
+			return
+		}
+
+		next()
+	}
+}
+
+// Runs the middleware chain, calling final once the chain completes
+//
+// Returns whether or not the event reached final
+func (w *GatewayClient) runMiddlewares(ctx *EventContext, evt events.EventInterface, final func()) bool {
+	mws := w.Middlewares
+
+	var dispatched bool
+
+	var run func(i int)
+	run = func(i int) {
+		if i >= len(mws) {
+			dispatched = true
+			final()
+			return
+		}
+
+		var called bool
+		mws[i](w, ctx, evt, func() {
+			// Guard against a middleware calling next more than once
+			if called {
+				return
+			}
+
+			called = true
+			run(i + 1)
+		})
+	}
+
+	run(0)
+
+	return dispatched
+}
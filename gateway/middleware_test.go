@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/gateway/events"
+	"go.uber.org/zap"
+)
+
+const (
+	testMessagePayload = `{"type":"Message","_id":"message","channel":"channel","author":"author","content":"hello"}`
+	testTypingPayload  = `{"type":"ChannelStartTyping","id":"channel","user":"author"}`
+)
+
+// Returns a gateway client that only dispatches events, without caching them
+func dispatchClient() *GatewayClient {
+	return &GatewayClient{
+		Encoding: "json",
+		Logger:   zap.NewNop(),
+		GatewayCache: GatewayCacher{
+			Disable: true,
+		},
+	}
+}
+
+// Returns a middleware appending name to calls before and after calling next
+func recordingMiddleware(calls *[]string, name string) Middleware {
+	return func(w *GatewayClient, ctx *EventContext, evt events.EventInterface, next func()) {
+		*calls = append(*calls, name)
+		next()
+		*calls = append(*calls, name+" done")
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	w := dispatchClient()
+
+	var calls []string
+	w.Use(recordingMiddleware(&calls, "a"), recordingMiddleware(&calls, "b"))
+	w.Use(recordingMiddleware(&calls, "c"))
+
+	_, err := CreateEvent[events.Message](w, []byte(testMessagePayload), func(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+		calls = append(calls, "handler")
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a", "b", "c", "handler", "c done", "b done", "a done"}
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("got calls %v, want %v", calls, want)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	w := dispatchClient()
+
+	var calls []string
+	w.Use(
+		recordingMiddleware(&calls, "a"),
+		func(w *GatewayClient, ctx *EventContext, evt events.EventInterface, next func()) {
+			calls = append(calls, "drop")
+		},
+		recordingMiddleware(&calls, "c"),
+	)
+
+	_, err := CreateEvent[events.Message](w, []byte(testMessagePayload), func(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+		calls = append(calls, "handler")
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a", "drop", "a done"}
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("got calls %v, want %v", calls, want)
+	}
+
+	if w.runMiddlewares(&EventContext{Type: "Message"}, &events.Message{}, func() {}) {
+		t.Fatal("runMiddlewares reported a dropped event as dispatched")
+	}
+}
+
+func TestMiddlewareNextCalledTwice(t *testing.T) {
+	w := dispatchClient()
+
+	w.Use(func(w *GatewayClient, ctx *EventContext, evt events.EventInterface, next func()) {
+		next()
+		next()
+	})
+
+	var handled int
+	_, err := CreateEvent[events.Message](w, []byte(testMessagePayload), func(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+		handled++
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if handled != 1 {
+		t.Fatalf("handler called %d times, want 1", handled)
+	}
+}
+
+func TestMiddlewareModifiesEvent(t *testing.T) {
+	w := dispatchClient()
+
+	w.Use(func(w *GatewayClient, ctx *EventContext, evt events.EventInterface, next func()) {
+		evt.(*events.Message).Content = "modified"
+		next()
+	})
+
+	var content string
+	_, err := CreateEvent[events.Message](w, []byte(testMessagePayload), func(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+		content = evt.Content
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content != "modified" {
+		t.Fatalf("handler got content %q, want modified", content)
+	}
+}
+
+func TestTypedMiddleware(t *testing.T) {
+	w := dispatchClient()
+
+	var seen []string
+	w.Use(TypedMiddleware(func(w *GatewayClient, ctx *EventContext, evt *events.Message, next func()) {
+		// Drop every message
+		seen = append(seen, evt.Id)
+	}))
+
+	var messages, typing int
+	_, err := CreateEvent[events.Message](w, []byte(testMessagePayload), func(w *GatewayClient, ctx *EventContext, evt *events.Message) {
+		messages++
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = CreateEvent[events.ChannelStartTyping](w, []byte(testTypingPayload), func(w *GatewayClient, ctx *EventContext, evt *events.ChannelStartTyping) {
+		typing++
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messages != 0 {
+		t.Fatal("typed middleware did not drop the message")
+	}
+
+	if typing != 1 {
+		t.Fatal("typed middleware did not pass other events through")
+	}
+
+	if !reflect.DeepEqual(seen, []string{"message"}) {
+		t.Fatalf("typed middleware saw %v, want [message]", seen)
+	}
+}
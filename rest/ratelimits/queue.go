@@ -0,0 +1,199 @@
+package ratelimits
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Priority of a request, requests with a higher priority are let through first
+// when a bucket is contended
+type Priority int
+
+const (
+	// Background requests such as bulk moderation sweeps
+	PriorityBackground Priority = -10
+
+	// The default priority
+	PriorityNormal Priority = 0
+
+	// User-facing requests such as command replies
+	PriorityInteractive Priority = 10
+)
+
+// Options for acquiring a bucket
+type AcquireOptions struct {
+	// Priority of the request
+	Priority Priority
+
+	// Maximum time to wait for the bucket (both in the queue and for the ratelimit
+	// to reset), 0 means no limit
+	//
+	// If the wait would exceed this, a *QueueTimeoutError is returned instead
+	MaxWait time.Duration
+
+	// Requests of the same priority are let through round-robin between fairness keys,
+	// this is usually the channel or server ID of the request (see MajorID)
+	FairnessKey string
+}
+
+// ErrQueueTimeout is the sentinel error for *QueueTimeoutError, use errors.Is to check for it
+var ErrQueueTimeout = errors.New("ratelimit queue wait exceeded")
+
+// QueueTimeoutError is returned when a request would have to wait longer than its MaxWait
+type QueueTimeoutError struct {
+	// The bucket that was being waited on
+	Bucket string
+
+	// How long the request waited for
+	Waited time.Duration
+
+	// The maximum wait time of the request
+	MaxWait time.Duration
+}
+
+func (e *QueueTimeoutError) Error() string {
+	return fmt.Sprintf("%s: bucket %s, waited %s (max %s)", ErrQueueTimeout.Error(), e.Bucket, e.Waited, e.MaxWait)
+}
+
+func (e *QueueTimeoutError) Unwrap() error {
+	return ErrQueueTimeout
+}
+
+// MajorID returns the first ID in a path, such as the channel ID of a message route
+//
+// This is the default fairness key of a request
+func MajorID(path string) string {
+	for _, seg := range splitPath(path) {
+		if idRegex.MatchString(seg) {
+			return seg
+		}
+	}
+
+	return ""
+}
+
+type queueWaiter struct {
+	opts  AcquireOptions
+	seq   uint64
+	ready chan struct{}
+}
+
+// Queue is a priority queue allowing one holder at a time
+//
+// Waiters are let through by priority, then round-robin between fairness keys
+// and then in arrival order
+type Queue struct {
+	mu         sync.Mutex
+	busy       bool
+	seq        uint64
+	waiters    []*queueWaiter
+	lastServed map[string]uint64
+}
+
+// Enter waits until the queue can be held, returning false if the deadline
+// (if non-zero) passes first
+//
+// Leave must be called once done if Enter returns true
+func (q *Queue) Enter(opts AcquireOptions, deadline time.Time) bool {
+	q.mu.Lock()
+
+	if !q.busy && len(q.waiters) == 0 {
+		q.busy = true
+		q.mu.Unlock()
+		return true
+	}
+
+	q.seq++
+	w := &queueWaiter{
+		opts:  opts,
+		seq:   q.seq,
+		ready: make(chan struct{}),
+	}
+
+	q.waiters = append(q.waiters, w)
+	q.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-w.ready:
+		return true
+	case <-timeout:
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		for i, other := range q.waiters {
+			if other == w {
+				q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+				return false
+			}
+		}
+
+		// We were let through just as the deadline passed
+		return true
+	}
+}
+
+// Leave lets the next waiter through
+func (q *Queue) Leave() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiters) == 0 {
+		q.busy = false
+		q.lastServed = nil
+		return
+	}
+
+	if q.lastServed == nil {
+		q.lastServed = make(map[string]uint64)
+	}
+
+	next := 0
+	for i, w := range q.waiters[1:] {
+		if q.before(w, q.waiters[next]) {
+			next = i + 1
+		}
+	}
+
+	w := q.waiters[next]
+	q.waiters = append(q.waiters[:next], q.waiters[next+1:]...)
+
+	q.seq++
+	q.lastServed[w.opts.FairnessKey] = q.seq
+
+	close(w.ready)
+}
+
+// Returns whether a should be let through before b
+func (q *Queue) before(a, b *queueWaiter) bool {
+	if a.opts.Priority != b.opts.Priority {
+		return a.opts.Priority > b.opts.Priority
+	}
+
+	if a.opts.FairnessKey != b.opts.FairnessKey {
+		// Least recently served fairness key first
+		la, lb := q.lastServed[a.opts.FairnessKey], q.lastServed[b.opts.FairnessKey]
+
+		if la != lb {
+			return la < lb
+		}
+	}
+
+	return a.seq < b.seq
+}
+
+// Len returns the number of waiters in the queue
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.waiters)
+}
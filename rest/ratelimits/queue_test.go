@@ -0,0 +1,129 @@
+package ratelimits
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Queues waiters on a held queue one by one, returning the order they were let through in
+func queueOrder(t *testing.T, waiters []AcquireOptions) []int {
+	t.Helper()
+
+	var q Queue
+
+	if !q.Enter(AcquireOptions{}, time.Time{}) {
+		t.Fatal("failed to enter empty queue")
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+
+	for i, opts := range waiters {
+		wg.Add(1)
+		go func(i int, opts AcquireOptions) {
+			defer wg.Done()
+
+			if !q.Enter(opts, time.Time{}) {
+				t.Error("failed to enter queue")
+				return
+			}
+
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+
+			q.Leave()
+		}(i, opts)
+
+		// Ensure arrival order
+		for q.Len() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	q.Leave()
+	wg.Wait()
+
+	return order
+}
+
+func TestQueuePriority(t *testing.T) {
+	order := queueOrder(t, []AcquireOptions{
+		{Priority: PriorityBackground},
+		{Priority: PriorityBackground},
+		{Priority: PriorityNormal},
+		{Priority: PriorityInteractive},
+	})
+
+	want := []int{3, 2, 0, 1}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestQueueFairness(t *testing.T) {
+	// A sweep of one channel must not starve another channel of the same priority
+	order := queueOrder(t, []AcquireOptions{
+		{FairnessKey: "a"},
+		{FairnessKey: "a"},
+		{FairnessKey: "a"},
+		{FairnessKey: "b"},
+	})
+
+	want := []int{0, 3, 1, 2}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestQueueMaxWait(t *testing.T) {
+	r := newLimiter()
+
+	held := r.LockBucket("GET:users/@me")
+
+	start := time.Now()
+	_, err := r.Acquire("GET:users/@me", AcquireOptions{MaxWait: 50 * time.Millisecond})
+
+	var qerr *QueueTimeoutError
+	if !errors.As(err, &qerr) || !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("expected *QueueTimeoutError, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatal("queue wait was not bounded")
+	}
+
+	if err := held.Release(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The timed out waiter must not hold up the queue
+	l, err := r.Acquire("GET:users/@me", AcquireOptions{MaxWait: 50 * time.Millisecond})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Release(nil)
+}
+
+func TestMajorID(t *testing.T) {
+	tests := map[string]string{
+		"channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages/01H3SPT5VV7J5XQ5615WJXHJC2": "01G11DTVYAJQCJJ9VZMA6GRND3",
+		"users/@me": "",
+		"servers/01G11DTVYAJNCD2JH2Q1TKKHAR/members?exclude_offline=true": "01G11DTVYAJNCD2JH2Q1TKKHAR",
+	}
+
+	for path, want := range tests {
+		if got := MajorID(path); got != want {
+			t.Errorf("MajorID(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
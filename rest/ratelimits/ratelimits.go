@@ -2,7 +2,6 @@
 package ratelimits
 
 import (
-	"math"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -14,7 +13,8 @@ import (
 	"go.uber.org/zap"
 )
 
-var channelMessageRegex = regexp.MustCompile(`channels\/[A-za-z0-9]+\/messages`)
+// Matches Revolt IDs (ULIDs) in a path
+var idRegex = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
 
 // customRateLimit holds information for defining a custom rate limit
 type CustomRateLimit struct {
@@ -23,22 +23,65 @@ type CustomRateLimit struct {
 	Reset    time.Duration
 }
 
-// RateLimiter holds all ratelimit buckets
-type RateLimiter struct {
+// RateLimiter is a ratelimiter backend, this allows for alternative implementations
+// such as a ratelimiter shared between multiple processes
+//
+// MemoryRateLimiter is the default implementation
+type RateLimiter interface {
+	// Acquire blocks until a request can be made on the bucket of the given key, the
+	// key is in the form METHOD:path
+	//
+	// The returned lock must be released exactly once using Release()
+	//
+	// Requests waiting on the same bucket are let through according to the options,
+	// see AcquireOptions
+	Acquire(key string, opts AcquireOptions) (BucketLock, error)
+
+	// SetGlobalReset locks all buckets until the given time
+	SetGlobalReset(reset time.Time) error
+
+	// SetLogger sets the logger of the ratelimiter
+	SetLogger(logger *zap.Logger)
+}
+
+// BucketLock is a lock on a ratelimit bucket returned by RateLimiter.Acquire
+type BucketLock interface {
+	// The ID of the bucket
+	ID() string
+
+	// Release releases the lock, updating the bucket using the ratelimit headers of the response
+	//
+	// Headers may be nil if no response was received
+	Release(headers http.Header) error
+}
+
+// MemoryRateLimiter holds all ratelimit buckets in memory
+//
+// Revolt assigns buckets server-side and returns the bucket ID in the X-RateLimit-Bucket
+// header. Until a route has been seen, it gets its own provisional bucket keyed by the route.
+// Once the server tells us the bucket of a route, the route is mapped onto the shared bucket.
+//
+// Revolt ratelimits channels and servers separately (see BucketResource), so routes and
+// buckets are kept per channel or server as well.
+type MemoryRateLimiter struct {
 	sync.Mutex
 	Global           *int64
 	Buckets          map[string]*Bucket
 	GlobalRateLimit  time.Duration
 	CustomRateLimits []*CustomRateLimit
 	Logger           *zap.Logger
+
+	// Maps routes (see Route and BucketKey) to server-assigned bucket IDs
+	Routes map[string]string
 }
 
-// NewRatelimiter returns a new RateLimiter
+// NewRatelimiter returns a new in-memory RateLimiter
 //
 // Be sure to set Logger to a valid logger
-func NewRatelimiter() *RateLimiter {
-	return &RateLimiter{
+func NewRatelimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
 		Buckets: make(map[string]*Bucket),
+		Routes:  make(map[string]string),
 		Global:  new(int64),
 		/*CustomRateLimits: []*CustomRateLimit{
 			{
@@ -50,8 +93,79 @@ func NewRatelimiter() *RateLimiter {
 	}
 }
 
+// Route returns the route of a request, this is the method and path with
+// IDs (and other variable segments) replaced with placeholders
+//
+// For example, "POST", "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages?x=y" becomes
+// "POST:channels/:id/messages"
+func Route(method, path string) string {
+	segments := splitPath(path)
+
+	for i, seg := range segments {
+		if i > 0 {
+			switch segments[i-1] {
+			case "reactions":
+				// Reactions may be unicode emojis
+				segments[i] = ":emoji"
+				continue
+			case "invites":
+				// Invite codes are not IDs
+				segments[i] = ":code"
+				continue
+			}
+		}
+
+		if idRegex.MatchString(seg) {
+			segments[i] = ":id"
+		}
+	}
+
+	return method + ":" + strings.Join(segments, "/")
+}
+
+// Top level resources Revolt keeps ratelimits for per resource
+var bucketResources = map[string]bool{
+	"channels": true,
+	"servers":  true,
+	"webhooks": true,
+}
+
+// BucketResource returns the ID of the resource a path is ratelimited for, such as the
+// channel of "channels/:id/messages" as sending messages in one channel does not count
+// towards the limit of another channel
+//
+// An empty string is returned for routes that are ratelimited globally, such as users
+func BucketResource(path string) string {
+	segments := splitPath(path)
+
+	if len(segments) < 2 || !bucketResources[segments[0]] || !idRegex.MatchString(segments[1]) {
+		return ""
+	}
+
+	return segments[1]
+}
+
+// BucketKey returns the key of a bucket (or a route) for a resource, see BucketResource
+func BucketKey(bucket, resource string) string {
+	if resource == "" {
+		return bucket
+	}
+
+	return bucket + "@" + resource
+}
+
+// Splits a path into its segments, ignoring the query string
+func splitPath(path string) []string {
+	path = strings.SplitN(path, "?", 2)[0]
+	path = strings.Trim(path, "/")
+
+	return strings.Split(path, "/")
+}
+
 // GetBucket retrieves or creates a bucket
-func (r *RateLimiter) GetBucket(pkey string) *Bucket {
+//
+// The key is in the form METHOD:path
+func (r *MemoryRateLimiter) GetBucket(pkey string) *Bucket {
 	r.Lock()
 	defer r.Unlock()
 
@@ -59,39 +173,29 @@ func (r *RateLimiter) GetBucket(pkey string) *Bucket {
 		panic("invalid bucket key: " + pkey)
 	}
 
-	split := strings.Split(pkey, ":")
+	split := strings.SplitN(pkey, ":", 2)
 
 	method, path := split[0], split[1]
 
-	// Specific bucket handles per method
-	//
-	// Non-exhaustive, but covers many cases
-	if method == "POST" {
-		// Match channels/:id/messages using regex
-		if channelMessageRegex.MatchString(path) {
-			r.Logger.Debug("Matches channels/:id/messages, using special bucket")
-			path = "post@channels/:id/messages"
-		}
-	} else if method == "DELETE" {
-		if strings.HasPrefix(path, "/auth") {
-			r.Logger.Debug("Matches /auth/*")
-			path = "delete@auth"
-		}
-	}
+	route := Route(method, path)
+	resource := BucketResource(path)
 
-	// Buckets on revolt are set based on prefix, so
-	bucketName := strings.Split(path, "/")
-
-	if len(bucketName) < 1 {
-		pkey = "global"
+	if r.Routes == nil {
+		r.Routes = make(map[string]string)
 	}
 
-	key := bucketName[0]
+	// Use the server-assigned bucket if we know it, otherwise use a provisional one
+	key := BucketKey(route, resource)
+	if id, ok := r.Routes[key]; ok {
+		key = BucketKey(id, resource)
+	}
 
 	r.Logger.Debug(
 		"Got bucket",
 		zap.String("method", method),
 		zap.String("pkey", pkey),
+		zap.String("route", route),
+		zap.String("resource", resource),
 		zap.String("parsedKey", key),
 		zap.Int64p("global", r.Global),
 	)
@@ -100,26 +204,74 @@ func (r *RateLimiter) GetBucket(pkey string) *Bucket {
 		return bucket
 	}
 
+	b := r.newBucket(key, route, resource)
+	r.Buckets[key] = b
+	return b
+}
+
+// Creates a new bucket, the ratelimiter must be locked
+func (r *MemoryRateLimiter) newBucket(key, route, resource string) *Bucket {
 	b := &Bucket{
 		Remaining: 1,
 		Key:       key,
+		Route:     route,
+		Resource:  resource,
 		Global:    r.Global,
+		limiter:   r,
 	}
 
 	// Check if there is a custom ratelimit set for this bucket ID.
 	for _, rl := range r.CustomRateLimits {
-		if strings.HasSuffix(b.Key, rl.Suffix) {
+		if strings.HasSuffix(b.Route, rl.Suffix) {
 			b.CustomRateLimit = rl
 			break
 		}
 	}
 
-	r.Buckets[key] = b
 	return b
 }
 
+// Maps the route of a (locked) bucket onto a server-assigned bucket of the same
+// resource, copying ratelimit info from the bucket
+func (r *MemoryRateLimiter) learnBucket(id string, from *Bucket) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.Routes == nil {
+		r.Routes = make(map[string]string)
+	}
+
+	route := BucketKey(from.Route, from.Resource)
+
+	if r.Routes[route] != id {
+		r.Logger.Debug("Learned bucket for route", zap.String("route", route), zap.String("bucket", id))
+		r.Routes[route] = id
+	}
+
+	key := BucketKey(id, from.Resource)
+	b, ok := r.Buckets[key]
+
+	if !ok {
+		b = r.newBucket(key, from.Route, from.Resource)
+		b.Remaining = from.Remaining
+		b.Limit = from.Limit
+		b.Reset = from.Reset
+		r.Buckets[key] = b
+		return
+	}
+
+	// Update the shared bucket if no one else is using it, otherwise
+	// its user will update it upon release
+	if b.TryLock() {
+		b.Remaining = from.Remaining
+		b.Limit = from.Limit
+		b.Reset = from.Reset
+		b.Unlock()
+	}
+}
+
 // GetWaitTime returns the duration you should wait for a Bucket
-func (r *RateLimiter) GetWaitTime(b *Bucket, minRemaining int) time.Duration {
+func (r *MemoryRateLimiter) GetWaitTime(b *Bucket, minRemaining int) time.Duration {
 	// If we ran out of calls and the reset time is still ahead of us
 	// then we need to take it easy and relax a little
 	if b.Remaining < minRemaining && b.Reset.After(time.Now()) {
@@ -135,22 +287,70 @@ func (r *RateLimiter) GetWaitTime(b *Bucket, minRemaining int) time.Duration {
 	return 0
 }
 
+// Acquire implements RateLimiter
+func (r *MemoryRateLimiter) Acquire(key string, opts AcquireOptions) (BucketLock, error) {
+	b, err := r.LockBucketObjectWith(r.GetBucket(key), opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// SetGlobalReset implements RateLimiter
+func (r *MemoryRateLimiter) SetGlobalReset(reset time.Time) error {
+	atomic.StoreInt64(r.Global, reset.UnixNano())
+	return nil
+}
+
+// SetLogger implements RateLimiter
+func (r *MemoryRateLimiter) SetLogger(logger *zap.Logger) {
+	r.Logger = logger
+}
+
 // LockBucket Locks until a request can be made
-func (r *RateLimiter) LockBucket(bucketID string) *Bucket {
+func (r *MemoryRateLimiter) LockBucket(bucketID string) *Bucket {
 	return r.LockBucketObject(r.GetBucket(bucketID))
 }
 
 // LockBucketObject Locks an already resolved bucket until a request can be made
-func (r *RateLimiter) LockBucketObject(b *Bucket) *Bucket {
+func (r *MemoryRateLimiter) LockBucketObject(b *Bucket) *Bucket {
+	// Without a MaxWait, this can never fail
+	b, _ = r.LockBucketObjectWith(b, AcquireOptions{})
+	return b
+}
+
+// LockBucketObjectWith Locks an already resolved bucket until a request can be made,
+// waiting in the bucket's queue according to the given options
+func (r *MemoryRateLimiter) LockBucketObjectWith(b *Bucket, opts AcquireOptions) (*Bucket, error) {
+	start := time.Now()
+
+	var deadline time.Time
+	if opts.MaxWait > 0 {
+		deadline = start.Add(opts.MaxWait)
+	}
+
+	if !b.queue.Enter(opts, deadline) {
+		return nil, &QueueTimeoutError{Bucket: b.Key, Waited: time.Since(start), MaxWait: opts.MaxWait}
+	}
+
 	b.Lock()
 
 	if wait := r.GetWaitTime(b, 1); wait > 0 {
+		// Fail fast if we would exceed the max wait
+		if opts.MaxWait > 0 && time.Since(start)+wait > opts.MaxWait {
+			b.Unlock()
+			b.queue.Leave()
+			return nil, &QueueTimeoutError{Bucket: b.Key, Waited: time.Since(start), MaxWait: opts.MaxWait}
+		}
+
 		r.Logger.Info("Waiting to lock bucket", zap.String("key", b.Key), zap.Duration("waitTime", wait))
 		time.Sleep(wait)
 	}
 
 	b.Remaining--
-	return b
+	return b, nil
 }
 
 // Bucket represents a ratelimit bucket, each bucket gets ratelimited individually (-global ratelimits)
@@ -162,14 +362,42 @@ type Bucket struct {
 	Reset     time.Time
 	Global    *int64
 
+	// The route that created this bucket
+	Route string
+
+	// The resource (channel or server) this bucket is for, see BucketResource
+	Resource string
+
 	LastReset       time.Time
 	CustomRateLimit *CustomRateLimit
 	Userdata        interface{}
+
+	limiter *MemoryRateLimiter
+
+	// Requests waiting for this bucket
+	queue Queue
+}
+
+// QueueLength returns the number of requests waiting for this bucket
+func (b *Bucket) QueueLength() int {
+	return b.queue.Len()
+}
+
+// ID returns the key of the bucket
+func (b *Bucket) ID() string {
+	return b.Key
 }
 
 // Release unlocks the bucket and reads the headers to update the buckets ratelimit info
-// and locks up the whole thing in case if there's a global ratelimit.
+//
+// Revolt sends the following headers:
+//   - X-RateLimit-Bucket: the server-assigned bucket ID
+//   - X-RateLimit-Limit: the number of requests allowed in the bucket
+//   - X-RateLimit-Remaining: the number of requests remaining in the bucket
+//   - X-RateLimit-Reset-After: milliseconds until the bucket resets
 func (b *Bucket) Release(headers http.Header) error {
+	// Let the next request in the queue through once unlocked
+	defer b.queue.Leave()
 	defer b.Unlock()
 
 	// Check if the bucket uses a custom ratelimiter
@@ -188,60 +416,80 @@ func (b *Bucket) Release(headers http.Header) error {
 		return nil
 	}
 
-	remaining := headers.Get("X-RateLimit-Remaining")
-	reset := headers.Get("X-RateLimit-Reset") // Discord only, but should be ignored
-	global := headers.Get("X-RateLimit-Global")
-	resetAfter := headers.Get("X-RateLimit-Reset-After")
+	h, err := ParseHeaders(headers)
 
-	// Update global and per bucket reset time if the proper headers are available
-	// If global is set, then it will block all buckets until after Retry-After
-	// If Retry-After without global is provided it will use that for the new reset
-	// time since it's more accurate than X-RateLimit-Reset.
-	// If Retry-After after is not proided, it will update the reset time from X-RateLimit-Reset
-	if resetAfter != "" {
-		parsedAfter, err := strconv.ParseFloat(resetAfter, 64)
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		return err
+	}
 
-		whole, frac := math.Modf(parsedAfter)
-		resetAt := time.Now().Add(time.Duration(whole) * time.Millisecond).Add(time.Duration(frac*1000) * time.Microsecond)
+	if h.Limit >= 0 {
+		b.Limit = h.Limit
+	}
 
-		// Lock either this single bucket or all buckets
-		if global != "" {
-			atomic.StoreInt64(b.Global, resetAt.UnixNano())
-		} else {
-			b.Reset = resetAt
-		}
-	} else if reset != "" {
-		// Calculate the reset time by using the date header returned from revolt
-		t, err := http.ParseTime(headers.Get("Date"))
+	if h.Remaining >= 0 {
+		b.Remaining = h.Remaining
+	}
+
+	if h.ResetAfter >= 0 {
+		b.Reset = time.Now().Add(h.ResetAfter)
+	}
+
+	// Map the route onto the server-assigned bucket
+	if h.Bucket != "" && BucketKey(h.Bucket, b.Resource) != b.Key && b.limiter != nil {
+		b.limiter.learnBucket(h.Bucket, b)
+	}
+
+	return nil
+}
+
+// Headers contains the ratelimit information returned by Revolt
+type Headers struct {
+	// The server-assigned bucket ID (X-RateLimit-Bucket), empty if not present
+	Bucket string
+
+	// The number of requests allowed in the bucket (X-RateLimit-Limit), -1 if not present
+	Limit int
+
+	// The number of requests remaining in the bucket (X-RateLimit-Remaining), -1 if not present
+	Remaining int
+
+	// Time until the bucket resets (X-RateLimit-Reset-After), -1 if not present
+	ResetAfter time.Duration
+}
+
+// ParseHeaders parses Revolt's ratelimit headers
+func ParseHeaders(headers http.Header) (*Headers, error) {
+	h := &Headers{
+		Bucket:     headers.Get("X-RateLimit-Bucket"),
+		Limit:      -1,
+		Remaining:  -1,
+		ResetAfter: -1,
+	}
+
+	if limit := headers.Get("X-RateLimit-Limit"); limit != "" {
+		parsedLimit, err := strconv.ParseInt(limit, 10, 32)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		h.Limit = int(parsedLimit)
+	}
 
-		unix, err := strconv.ParseFloat(reset, 64)
+	if remaining := headers.Get("X-RateLimit-Remaining"); remaining != "" {
+		parsedRemaining, err := strconv.ParseInt(remaining, 10, 32)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		// Calculate the time until reset and add it to the current local time
-		// some extra time is added
-		//
-		// as revolt experiences constant ddos, we set a higher reset time
-		whole, frac := math.Modf(unix)
-		delta := time.Unix(int64(whole), 0).Add(time.Duration(frac*1000)*time.Millisecond).Sub(t) + time.Millisecond*325
-		b.Reset = time.Now().Add(delta)
+		h.Remaining = int(parsedRemaining)
 	}
 
-	// Update remaining if header is present
-	if remaining != "" {
-		parsedRemaining, err := strconv.ParseInt(remaining, 10, 32)
+	// Revolt sends this in milliseconds
+	if resetAfter := headers.Get("X-RateLimit-Reset-After"); resetAfter != "" {
+		parsedAfter, err := strconv.ParseFloat(resetAfter, 64)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		b.Remaining = int(parsedRemaining)
+		h.ResetAfter = time.Duration(parsedAfter * float64(time.Millisecond))
 	}
 
-	return nil
+	return h, nil
 }
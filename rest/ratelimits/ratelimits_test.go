@@ -0,0 +1,278 @@
+package ratelimits
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newLimiter() *MemoryRateLimiter {
+	r := NewRatelimiter()
+	r.Logger = zap.NewNop()
+	return r
+}
+
+// Creates a http.Header from key-value pairs
+func headers(kv ...string) http.Header {
+	h := http.Header{}
+	for i := 0; i < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "users/@me", "GET:users/@me"},
+		{"GET", "users/01FD58YK5W7QRV5H3D64KTQYX3", "GET:users/:id"},
+		{"GET", "users/01FD58YK5W7QRV5H3D64KTQYX3/profile", "GET:users/:id/profile"},
+		{"POST", "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages", "POST:channels/:id/messages"},
+		{"GET", "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages?limit=10&include_users=true", "GET:channels/:id/messages"},
+		{"DELETE", "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages/01H3SPT5VV7J5XQ5615WJXHJC2", "DELETE:channels/:id/messages/:id"},
+		{"PUT", "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages/01H3SPT5VV7J5XQ5615WJXHJC2/reactions/👍", "PUT:channels/:id/messages/:id/reactions/:emoji"},
+		{"GET", "invites/Testers", "GET:invites/:code"},
+		{"DELETE", "/auth/session/all", "DELETE:auth/session/all"},
+	}
+
+	for _, tt := range tests {
+		if got := Route(tt.method, tt.path); got != tt.want {
+			t.Errorf("Route(%q, %q) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestBucketResource(t *testing.T) {
+	tests := map[string]string{
+		"channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages?limit=10": "01G11DTVYAJQCJJ9VZMA6GRND3",
+		"servers/01G11DTVYAJNCD2JH2Q1TKKHAR/members":            "01G11DTVYAJNCD2JH2Q1TKKHAR",
+		"users/01FD58YK5W7QRV5H3D64KTQYX3":                      "",
+		"servers/create":                                        "",
+	}
+
+	for path, want := range tests {
+		if got := BucketResource(path); got != want {
+			t.Errorf("BucketResource(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name          string
+		headers       http.Header
+		wantLimit     int
+		wantRemaining int
+		wantReset     time.Duration
+		wantErr       bool
+	}{
+		{
+			name: "users",
+			headers: headers(
+				"X-RateLimit-Bucket", "2ac6bc5f1bd7e2b8",
+				"X-RateLimit-Limit", "20",
+				"X-RateLimit-Remaining", "19",
+				"X-RateLimit-Reset-After", "9986",
+			),
+			wantLimit:     20,
+			wantRemaining: 19,
+			wantReset:     9986 * time.Millisecond,
+		},
+		{
+			name: "messaging exhausted",
+			headers: headers(
+				"X-RateLimit-Bucket", "5bb8c0d5a1f1b7e3",
+				"X-RateLimit-Limit", "10",
+				"X-RateLimit-Remaining", "0",
+				"X-RateLimit-Reset-After", "4312",
+			),
+			wantLimit:     10,
+			wantRemaining: 0,
+			wantReset:     4312 * time.Millisecond,
+		},
+		{
+			// LockBucket consumes the only provisional request
+			name:          "no headers",
+			headers:       headers(),
+			wantLimit:     0,
+			wantRemaining: 0,
+		},
+		{
+			name: "invalid remaining",
+			headers: headers(
+				"X-RateLimit-Remaining", "abc",
+			),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLimiter()
+			b := r.LockBucket("GET:users/01FD58YK5W7QRV5H3D64KTQYX3")
+
+			start := time.Now()
+			err := b.Release(tt.headers)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Reload the bucket, it may have been mapped onto a server-assigned bucket
+			b = r.GetBucket("GET:users/01FD58YK5W7QRV5H3D64KTQYX3")
+
+			if b.Limit != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", b.Limit, tt.wantLimit)
+			}
+
+			if b.Remaining != tt.wantRemaining {
+				t.Errorf("remaining = %d, want %d", b.Remaining, tt.wantRemaining)
+			}
+
+			if tt.wantReset > 0 {
+				reset := b.Reset.Sub(start)
+				if reset < tt.wantReset || reset > tt.wantReset+time.Second {
+					t.Errorf("reset in %s, want %s", reset, tt.wantReset)
+				}
+			}
+
+			if bucket := tt.headers.Get("X-RateLimit-Bucket"); bucket != "" && b.Key != bucket {
+				t.Errorf("bucket key = %q, want %q", b.Key, bucket)
+			}
+		})
+	}
+}
+
+func TestLearnSharedBucket(t *testing.T) {
+	r := newLimiter()
+
+	// Two routes that revolt places in the same bucket
+	a := r.LockBucket("GET:users/01FD58YK5W7QRV5H3D64KTQYX3")
+	err := a.Release(headers(
+		"X-RateLimit-Bucket", "2ac6bc5f1bd7e2b8",
+		"X-RateLimit-Limit", "20",
+		"X-RateLimit-Remaining", "5",
+		"X-RateLimit-Reset-After", "1000",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := r.LockBucket("GET:users/@me")
+	err = b.Release(headers(
+		"X-RateLimit-Bucket", "2ac6bc5f1bd7e2b8",
+		"X-RateLimit-Limit", "20",
+		"X-RateLimit-Remaining", "4",
+		"X-RateLimit-Reset-After", "900",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := r.GetBucket("GET:users/01FEZ09YRQ02C5XVBW6DG4QFQC")
+	second := r.GetBucket("GET:users/@me")
+
+	if first != second {
+		t.Fatalf("expected routes to share a bucket, got %q and %q", first.Key, second.Key)
+	}
+
+	if first.Remaining != 4 {
+		t.Errorf("remaining = %d, want 4", first.Remaining)
+	}
+
+	// A route in another bucket must not be affected
+	other := r.GetBucket("POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages")
+
+	if other == first {
+		t.Fatal("unrelated route mapped onto shared bucket")
+	}
+}
+
+func TestBucketPerChannel(t *testing.T) {
+	r := newLimiter()
+
+	const (
+		channelA = "POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages"
+		channelB = "POST:channels/01H3SPT5VV7J5XQ5615WJXHJC2/messages"
+	)
+
+	// Both channels are placed in the messaging bucket, but are ratelimited separately
+	a := r.LockBucket(channelA)
+	err := a.Release(headers(
+		"X-RateLimit-Bucket", "5bb8c0d5a1f1b7e3",
+		"X-RateLimit-Limit", "10",
+		"X-RateLimit-Remaining", "0",
+		"X-RateLimit-Reset-After", "5000",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := r.LockBucket(channelB)
+	err = b.Release(headers(
+		"X-RateLimit-Bucket", "5bb8c0d5a1f1b7e3",
+		"X-RateLimit-Limit", "10",
+		"X-RateLimit-Remaining", "9",
+		"X-RateLimit-Reset-After", "5000",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b = r.GetBucket(channelA), r.GetBucket(channelB)
+
+	if a == b {
+		t.Fatalf("channels share bucket %q", a.Key)
+	}
+
+	if a.Key != "5bb8c0d5a1f1b7e3@01G11DTVYAJQCJJ9VZMA6GRND3" || b.Key != "5bb8c0d5a1f1b7e3@01H3SPT5VV7J5XQ5615WJXHJC2" {
+		t.Fatalf("unexpected bucket keys %q and %q", a.Key, b.Key)
+	}
+
+	// The exhausted channel must not hold back the other one
+	if a.Remaining != 0 || b.Remaining != 9 {
+		t.Fatalf("remaining = %d and %d, want 0 and 9", a.Remaining, b.Remaining)
+	}
+
+	if wait := r.GetWaitTime(b, 1); wait != 0 {
+		t.Fatalf("channel waits %s for another channel's bucket", wait)
+	}
+}
+
+func TestWaitTime(t *testing.T) {
+	r := newLimiter()
+
+	b := r.LockBucket("POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages")
+	err := b.Release(headers(
+		"X-RateLimit-Bucket", "5bb8c0d5a1f1b7e3",
+		"X-RateLimit-Limit", "10",
+		"X-RateLimit-Remaining", "0",
+		"X-RateLimit-Reset-After", "200",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b = r.GetBucket("POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages")
+
+	if wait := r.GetWaitTime(b, 1); wait <= 0 || wait > 200*time.Millisecond {
+		t.Fatalf("wait time = %s, want (0, 200ms]", wait)
+	}
+}
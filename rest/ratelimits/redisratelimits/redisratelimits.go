@@ -0,0 +1,356 @@
+// Package redisratelimits provides a ratelimiter backed by Redis (or any server
+// implementing the Redis protocol) allowing multiple processes using the same
+// token to share ratelimit buckets
+package redisratelimits
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Atomically checks a bucket, consuming a request if one is available
+//
+// KEYS[1] = bucket key, KEYS[2] = global key
+// ARGV[1] = now (ms), ARGV[2] = lease time (ms)
+//
+// Returns {wait (ms), leased}, where leased is 1 if the bucket was unknown and
+// has been locked until the lock is released
+var acquireScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local lease = tonumber(ARGV[2])
+
+local global = tonumber(redis.call('GET', KEYS[2]) or '0')
+if global > now then
+	return {global - now, 0}
+end
+
+local b = redis.call('HMGET', KEYS[1], 'remaining', 'reset', 'limit')
+local remaining = tonumber(b[1])
+local reset = tonumber(b[2])
+local limit = tonumber(b[3])
+
+if remaining ~= nil and reset ~= nil and reset <= now then
+	-- The bucket has reset
+	if limit ~= nil and limit > 0 then
+		remaining = limit
+	else
+		remaining = nil
+	end
+end
+
+if remaining == nil then
+	-- Unknown bucket, lock it until the request completes and we know its limits
+	redis.call('HSET', KEYS[1], 'remaining', 0, 'reset', now + lease)
+	redis.call('PEXPIRE', KEYS[1], lease)
+	return {0, 1}
+end
+
+if remaining < 1 then
+	return {reset - now, 0}
+end
+
+redis.call('HSET', KEYS[1], 'remaining', remaining - 1)
+return {0, 0}
+`)
+
+// ErrNoHashTag is returned when using a Redis Cluster with a prefix without a hash tag
+var ErrNoHashTag = errors.New("redis cluster requires a prefix containing a hash tag, such as {grevolt:ratelimits}:")
+
+// RedisRateLimiter is a ratelimits.RateLimiter whose buckets are stored in Redis
+//
+// Like the in-memory ratelimiter, routes are mapped onto the server-assigned buckets
+// returned in the X-RateLimit-Bucket header, these mappings are shared as well. Routes
+// and buckets are kept per channel or server, see ratelimits.BucketResource.
+type RedisRateLimiter struct {
+	// The redis client to use
+	Client redis.UniversalClient
+
+	// Prefix for all keys, defaults to "{grevolt:ratelimits}:"
+	//
+	// Scripts and transactions use several keys at once, so on a Redis Cluster the
+	// prefix must contain a hash tag (such as "{grevolt:ratelimits}") placing all keys
+	// in the same hash slot
+	Prefix string
+
+	// How long an unknown bucket is locked for while its first request is made, defaults to 30 seconds
+	//
+	// This should be at least as long as the request timeout
+	LeaseTimeout time.Duration
+
+	// How long a route to bucket mapping is kept for, defaults to 24 hours
+	RouteTTL time.Duration
+
+	// Maximum time to sleep before checking a bucket again, defaults to 250 milliseconds
+	PollInterval time.Duration
+
+	// Logger to use
+	Logger *zap.Logger
+
+	// Local queues of requests waiting for a bucket
+	queuesLock sync.Mutex
+	queues     map[string]*ratelimits.Queue
+}
+
+// New returns a new redis-backed ratelimiter with the default configuration
+func New(client redis.UniversalClient) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		Client:       client,
+		Prefix:       "{grevolt:ratelimits}:",
+		LeaseTimeout: 30 * time.Second,
+		RouteTTL:     24 * time.Hour,
+		PollInterval: 250 * time.Millisecond,
+		Logger:       zap.NewNop(),
+	}
+}
+
+func (r *RedisRateLimiter) routeKey(route string) string {
+	return r.Prefix + "route:" + route
+}
+
+func (r *RedisRateLimiter) bucketKey(id string) string {
+	return r.Prefix + "bucket:" + id
+}
+
+func (r *RedisRateLimiter) globalKey() string {
+	return r.Prefix + "global"
+}
+
+// Returns an error if the keys of the ratelimiter would be spread over several hash
+// slots of a cluster
+func (r *RedisRateLimiter) checkCluster() error {
+	if _, ok := r.Client.(*redis.ClusterClient); !ok {
+		return nil
+	}
+
+	// Only the part between the first { and the following } is hashed
+	start := strings.Index(r.Prefix, "{")
+	if start == -1 {
+		return ErrNoHashTag
+	}
+
+	if end := strings.Index(r.Prefix[start+1:], "}"); end <= 0 {
+		return ErrNoHashTag
+	}
+
+	return nil
+}
+
+// Returns the local queue of a bucket
+func (r *RedisRateLimiter) queue(id string) *ratelimits.Queue {
+	r.queuesLock.Lock()
+	defer r.queuesLock.Unlock()
+
+	if r.queues == nil {
+		r.queues = make(map[string]*ratelimits.Queue)
+	}
+
+	q, ok := r.queues[id]
+
+	if !ok {
+		q = &ratelimits.Queue{}
+		r.queues[id] = q
+	}
+
+	return q
+}
+
+// Acquire implements ratelimits.RateLimiter
+//
+// Priority and fairness only apply between requests of this process waiting
+// for the same bucket, requests are not serialized across processes
+func (r *RedisRateLimiter) Acquire(key string, opts ratelimits.AcquireOptions) (ratelimits.BucketLock, error) {
+	ctx := context.Background()
+	start := time.Now()
+
+	if err := r.checkCluster(); err != nil {
+		return nil, err
+	}
+
+	split := strings.SplitN(key, ":", 2)
+
+	if len(split) != 2 {
+		panic("invalid bucket key: " + key)
+	}
+
+	resource := ratelimits.BucketResource(split[1])
+	route := ratelimits.BucketKey(ratelimits.Route(split[0], split[1]), resource)
+
+	// Use the server-assigned bucket if we know it, otherwise use a provisional one
+	id, err := r.Client.Get(ctx, r.routeKey(route)).Result()
+
+	if err == redis.Nil {
+		id = route
+	} else if err != nil {
+		return nil, err
+	} else {
+		id = ratelimits.BucketKey(id, resource)
+	}
+
+	var deadline time.Time
+	if opts.MaxWait > 0 {
+		deadline = start.Add(opts.MaxWait)
+	}
+
+	// Only one local request at a time checks the bucket, letting requests through by priority
+	q := r.queue(id)
+
+	if !q.Enter(opts, deadline) {
+		return nil, &ratelimits.QueueTimeoutError{Bucket: id, Waited: time.Since(start), MaxWait: opts.MaxWait}
+	}
+
+	defer q.Leave()
+
+	for {
+		res, err := acquireScript.Run(
+			ctx,
+			r.Client,
+			[]string{r.bucketKey(id), r.globalKey()},
+			time.Now().UnixMilli(),
+			r.LeaseTimeout.Milliseconds(),
+		).Int64Slice()
+
+		if err != nil {
+			return nil, err
+		}
+
+		wait, leased := time.Duration(res[0])*time.Millisecond, res[1] == 1
+
+		if wait <= 0 {
+			r.Logger.Debug(
+				"Acquired bucket",
+				zap.String("route", route),
+				zap.String("bucket", id),
+				zap.Bool("leased", leased),
+			)
+
+			return &redisBucketLock{
+				limiter:  r,
+				route:    route,
+				resource: resource,
+				id:       id,
+				leased:   leased,
+			}, nil
+		}
+
+		// Fail fast if we would exceed the max wait
+		if opts.MaxWait > 0 && time.Since(start)+wait > opts.MaxWait {
+			return nil, &ratelimits.QueueTimeoutError{Bucket: id, Waited: time.Since(start), MaxWait: opts.MaxWait}
+		}
+
+		r.Logger.Info("Waiting to lock bucket", zap.String("key", id), zap.Duration("waitTime", wait))
+
+		// The bucket may be released earlier by another process
+		if r.PollInterval > 0 && wait > r.PollInterval {
+			wait = r.PollInterval
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+// SetGlobalReset implements ratelimits.RateLimiter
+func (r *RedisRateLimiter) SetGlobalReset(reset time.Time) error {
+	if err := r.checkCluster(); err != nil {
+		return err
+	}
+
+	ttl := time.Until(reset)
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	return r.Client.Set(context.Background(), r.globalKey(), reset.UnixMilli(), ttl).Err()
+}
+
+// SetLogger implements ratelimits.RateLimiter
+func (r *RedisRateLimiter) SetLogger(logger *zap.Logger) {
+	r.Logger = logger
+}
+
+type redisBucketLock struct {
+	limiter  *RedisRateLimiter
+	route    string
+	resource string
+	id       string
+	leased   bool
+}
+
+// ID implements ratelimits.BucketLock
+func (l *redisBucketLock) ID() string {
+	return l.id
+}
+
+// Release implements ratelimits.BucketLock
+func (l *redisBucketLock) Release(headers http.Header) error {
+	ctx := context.Background()
+	r := l.limiter
+
+	var h *ratelimits.Headers
+	if headers != nil {
+		var err error
+		h, err = ratelimits.ParseHeaders(headers)
+
+		if err != nil {
+			// Don't keep an unknown bucket locked until the lease expires
+			if l.leased {
+				r.Client.Del(ctx, r.bucketKey(l.id))
+			}
+
+			return err
+		}
+	}
+
+	if h == nil || h.Remaining < 0 || h.ResetAfter < 0 {
+		// No ratelimit info, unlock the bucket if we locked it
+		if l.leased {
+			return r.Client.Del(ctx, r.bucketKey(l.id)).Err()
+		}
+
+		return nil
+	}
+
+	id := l.id
+	if h.Bucket != "" {
+		id = ratelimits.BucketKey(h.Bucket, l.resource)
+	}
+
+	now := time.Now()
+
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields := []any{
+			"remaining", h.Remaining,
+			"reset", now.Add(h.ResetAfter).UnixMilli(),
+		}
+
+		if h.Limit >= 0 {
+			fields = append(fields, "limit", h.Limit)
+		}
+
+		pipe.HSet(ctx, r.bucketKey(id), fields...)
+
+		// Keep the bucket around for a while after it resets so the limit is remembered
+		pipe.PExpire(ctx, r.bucketKey(id), h.ResetAfter+r.RouteTTL)
+
+		if id != l.id {
+			r.Logger.Debug("Learned bucket for route", zap.String("route", l.route), zap.String("bucket", id))
+			pipe.Set(ctx, r.routeKey(l.route), h.Bucket, r.RouteTTL)
+
+			if l.leased {
+				pipe.Del(ctx, r.bucketKey(l.id))
+			}
+		}
+
+		return nil
+	})
+
+	return err
+}
@@ -0,0 +1,306 @@
+package redisratelimits
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
+	"github.com/redis/go-redis/v9"
+)
+
+// Starts a local redis server, returning two ratelimiters (processes) sharing it
+func newLimiters(t *testing.T) (*miniredis.Miniredis, *RedisRateLimiter, *RedisRateLimiter) {
+	t.Helper()
+
+	srv := miniredis.RunT(t)
+
+	a := New(redis.NewClient(&redis.Options{Addr: srv.Addr()}))
+	b := New(redis.NewClient(&redis.Options{Addr: srv.Addr()}))
+
+	a.PollInterval = 10 * time.Millisecond
+	b.PollInterval = 10 * time.Millisecond
+
+	return srv, a, b
+}
+
+func headers(kv ...string) http.Header {
+	h := http.Header{}
+	for i := 0; i < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+func mustAcquire(t *testing.T, r ratelimits.RateLimiter, key string) ratelimits.BucketLock {
+	t.Helper()
+
+	l, err := r.Acquire(key, ratelimits.AcquireOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestImplementsRateLimiter(t *testing.T) {
+	var _ ratelimits.RateLimiter = &RedisRateLimiter{}
+}
+
+func TestSharedBucket(t *testing.T) {
+	_, a, b := newLimiters(t)
+
+	l := mustAcquire(t, a, "GET:users/01FD58YK5W7QRV5H3D64KTQYX3")
+
+	err := l.Release(headers(
+		"X-RateLimit-Bucket", "2ac6bc5f1bd7e2b8",
+		"X-RateLimit-Limit", "2",
+		"X-RateLimit-Remaining", "1",
+		"X-RateLimit-Reset-After", "300",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The other process must use the learned bucket and consume the last request
+	l = mustAcquire(t, b, "GET:users/01FEZ09YRQ02C5XVBW6DG4QFQC")
+
+	if l.ID() != "2ac6bc5f1bd7e2b8" {
+		t.Fatalf("expected learned bucket, got %q", l.ID())
+	}
+
+	if err := l.Release(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bucket is exhausted, so this must wait for the reset
+	start := time.Now()
+	l = mustAcquire(t, a, "GET:users/@me")
+
+	if l.ID() != "GET:users/@me" {
+		// users/@me has not been learned yet and so uses a provisional bucket
+		t.Fatalf("unexpected bucket %q", l.ID())
+	}
+
+	l.Release(nil)
+
+	l = mustAcquire(t, a, "GET:users/01FD58YK5W7QRV5H3D64KTQYX3")
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Fatalf("expected to wait for the bucket to reset, waited %s", waited)
+	}
+
+	l.Release(nil)
+}
+
+func TestBucketPerChannel(t *testing.T) {
+	_, a, b := newLimiters(t)
+
+	l := mustAcquire(t, a, "POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages")
+
+	err := l.Release(headers(
+		"X-RateLimit-Bucket", "5bb8c0d5a1f1b7e3",
+		"X-RateLimit-Limit", "10",
+		"X-RateLimit-Remaining", "0",
+		"X-RateLimit-Reset-After", "5000",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another channel in the messaging bucket must not wait for the exhausted channel
+	start := time.Now()
+	l = mustAcquire(t, b, "POST:channels/01H3SPT5VV7J5XQ5615WJXHJC2/messages")
+
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("waited %s for another channel's bucket", waited)
+	}
+
+	if l.ID() != "POST:channels/:id/messages@01H3SPT5VV7J5XQ5615WJXHJC2" {
+		t.Fatalf("unexpected bucket %q", l.ID())
+	}
+
+	l.Release(nil)
+
+	// The learned bucket is used for the same channel
+	_, err = b.Acquire("POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages", ratelimits.AcquireOptions{MaxWait: 100 * time.Millisecond})
+
+	if !errors.Is(err, ratelimits.ErrQueueTimeout) {
+		t.Fatalf("expected exhausted channel to time out, got %v", err)
+	}
+}
+
+func TestUnknownBucketIsLeased(t *testing.T) {
+	_, a, b := newLimiters(t)
+
+	l := mustAcquire(t, a, "POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages")
+
+	acquired := make(chan struct{})
+	go func() {
+		l := mustAcquire(t, b, "POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages")
+		l.Release(nil)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired an unknown bucket while it was leased")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := l.Release(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lease was not released")
+	}
+}
+
+func TestGlobalReset(t *testing.T) {
+	_, a, b := newLimiters(t)
+
+	if err := a.SetGlobalReset(time.Now().Add(150 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	l := mustAcquire(t, b, "GET:users/@me")
+	l.Release(nil)
+
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Fatalf("expected to wait for the global ratelimit, waited %s", waited)
+	}
+}
+
+func TestConcurrentAcquire(t *testing.T) {
+	_, a, b := newLimiters(t)
+
+	l := mustAcquire(t, a, "GET:servers/01G11DTVYAJNCD2JH2Q1TKKHAR")
+	err := l.Release(headers(
+		"X-RateLimit-Bucket", "servers",
+		"X-RateLimit-Limit", "5",
+		"X-RateLimit-Remaining", "5",
+		"X-RateLimit-Reset-After", "200",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var times []time.Duration
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(r *RedisRateLimiter) {
+			defer wg.Done()
+
+			l, err := r.Acquire("GET:servers/01G11DTVYAJNCD2JH2Q1TKKHAR", ratelimits.AcquireOptions{})
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			times = append(times, time.Since(start))
+			mu.Unlock()
+
+			l.Release(nil)
+		}([]*RedisRateLimiter{a, b}[i%2])
+	}
+
+	wg.Wait()
+
+	// Only 5 requests may go through before the reset
+	var early int
+	for _, d := range times {
+		if d < 150*time.Millisecond {
+			early++
+		}
+	}
+
+	if early != 5 {
+		t.Fatalf("expected 5 requests before reset, got %d", early)
+	}
+}
+
+func TestMaxWait(t *testing.T) {
+	_, a, _ := newLimiters(t)
+
+	l := mustAcquire(t, a, "GET:users/@me")
+	err := l.Release(headers(
+		"X-RateLimit-Bucket", "users",
+		"X-RateLimit-Limit", "1",
+		"X-RateLimit-Remaining", "0",
+		"X-RateLimit-Reset-After", "5000",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = a.Acquire("GET:users/@me", ratelimits.AcquireOptions{MaxWait: 100 * time.Millisecond})
+
+	if !errors.Is(err, ratelimits.ErrQueueTimeout) {
+		t.Fatalf("expected queue timeout, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatal("expected to fail fast")
+	}
+}
+
+func TestCluster(t *testing.T) {
+	srv := miniredis.RunT(t)
+
+	// miniredis serves every hash slot, so it can be used as a single node cluster
+	r := New(redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{srv.Addr()}}))
+	r.PollInterval = 10 * time.Millisecond
+
+	l := mustAcquire(t, r, "POST:channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages")
+
+	err := l.Release(headers(
+		"X-RateLimit-Bucket", "5bb8c0d5a1f1b7e3",
+		"X-RateLimit-Limit", "10",
+		"X-RateLimit-Remaining", "9",
+		"X-RateLimit-Reset-After", "5000",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SetGlobalReset(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Scripts and transactions use several keys, they must all be in the same hash slot
+	for _, key := range srv.Keys() {
+		if !strings.HasPrefix(key, "{grevolt:ratelimits}:") {
+			t.Fatalf("key %q is not under the hash tag", key)
+		}
+	}
+
+	if len(srv.Keys()) != 3 {
+		t.Fatalf("got keys %v, want the bucket, route and global keys", srv.Keys())
+	}
+
+	r.Prefix = "grevolt:ratelimits:"
+
+	if _, err := r.Acquire("GET:users/@me", ratelimits.AcquireOptions{}); !errors.Is(err, ErrNoHashTag) {
+		t.Fatalf("expected ErrNoHashTag, got %v", err)
+	}
+}
@@ -7,13 +7,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
 	"github.com/infinitybotlist/grevolt/types"
 	"github.com/infinitybotlist/grevolt/version"
-	"github.com/sethgrid/pester"
 	"go.uber.org/zap"
 )
 
@@ -23,24 +22,50 @@ func (r Request[T]) Request(config *RestConfig) (*http.Response, error) {
 		r.Method = GET
 	}
 
-	if r.bucket == nil {
-		r.bucket = config.Ratelimiter.LockBucket(string(r.Method) + ":" + strings.SplitN(r.Path, "?", 2)[0])
-	}
+	bucketKey := string(r.Method) + ":" + strings.SplitN(r.Path, "?", 2)[0]
 
-	if r.sequence > 0 {
-		// Exp backoff, 2^sequence * 100ms
-		time.Sleep(time.Duration(1<<r.sequence) * 100 * time.Millisecond)
+	if r.started.IsZero() {
+		r.started = time.Now()
 	}
 
-	if r.bucket != nil {
-		config.Logger.Debug(
-			"Acquired bucket",
-			zap.String("key", r.bucket.Key),
-			zap.Int("limit", r.bucket.Limit),
-			zap.Int("remaining", r.bucket.Remaining),
-		)
+	if r.bucket == nil {
+		opts := ratelimits.AcquireOptions{
+			Priority:    r.Priority,
+			MaxWait:     r.MaxQueueWait,
+			FairnessKey: r.FairnessKey,
+		}
+
+		if opts.Priority == 0 {
+			opts.Priority = config.Priority
+		}
+
+		if opts.MaxWait == 0 {
+			opts.MaxWait = config.MaxQueueWait
+		}
+
+		if opts.FairnessKey == "" {
+			opts.FairnessKey = ratelimits.MajorID(r.Path)
+		}
+
+		start := time.Now()
+		bucket, err := config.Ratelimiter.Acquire(bucketKey, opts)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire ratelimit bucket: %w", err)
+		}
+
+		r.bucket = bucket
+
+		if wait := time.Since(start); wait >= minReportedWait {
+			r.reportRatelimit(config, RatelimitWait, bucket.ID(), wait)
+		}
 	}
 
+	config.Logger.Debug(
+		"Acquired bucket",
+		zap.String("key", r.bucket.ID()),
+	)
+
 	var body []byte
 	var err error
 	if r.Json != nil {
@@ -66,91 +91,182 @@ func (r Request[T]) Request(config *RestConfig) (*http.Response, error) {
 	}
 
 	for k, v := range r.Headers {
-		req.Header.Add(k, v)
+		req.Header.Set(k, v)
 	}
 
 	for _, cookie := range r.Cookies {
 		req.AddCookie(&cookie)
 	}
 
-	req.Header.Add("Content-Type", "application/json")
+	// Let revolt deduplicate retried messages
+	if d, ok := r.Json.(*types.DataMessageSend); ok && d != nil && d.Nonce != "" && req.Header.Get("Idempotency-Key") == "" {
+		req.Header.Set("Idempotency-Key", d.Nonce)
+	}
 
-	config.Pester.Timeout = config.Timeout
-	config.Pester.MaxRetries = config.MaxRestRetries
-	config.Pester.Backoff = pester.ExponentialBackoff
-	config.Pester.KeepLog = true
-	config.Pester.RetryOnHTTP429 = false
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	resp, err := pester.Do(req)
+	resp, err := runInterceptors(config.Interceptors, &InterceptedRequest{
+		Method:  r.Method,
+		Path:    r.Path,
+		Request: req,
+		Body:    body,
+		Retry:   r.sequence,
+		Config:  config,
+	}, send)
 
 	if err != nil {
 		r.bucket.Release(nil)
+
+		if delay, ok := r.shouldRetry(config.Retry); ok && config.Retry.RetryNetworkErrors {
+			config.Logger.Error("Request failed, retrying...", zap.String("path", r.Path), zap.Error(err), zap.Duration("retryIn", delay))
+			return r.retry(config, delay)
+		}
+
 		return nil, err
 	}
 
 	err = r.bucket.Release(resp.Header)
 	if err != nil {
+		closeBody(resp.Body)
 		return nil, err
 	}
 
-	switch resp.StatusCode {
-	case http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusServiceUnavailable:
-		// Retry sending request if possible
-		if r.sequence < config.MaxRestRetries {
-
-			config.Logger.Error("Request failed, retrying...", zap.String("path", r.Path), zap.String("status", resp.Status))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return r.handleRatelimit(config, resp)
+	}
 
-			config.Ratelimiter.LockBucketObject(r.bucket)
-			r.sequence++
+	if config.Retry != nil && config.Retry.RetryStatus(resp.StatusCode) {
+		if delay, ok := r.shouldRetry(config.Retry); ok {
+			config.Logger.Error("Request failed, retrying...", zap.String("path", r.Path), zap.String("status", resp.Status), zap.Duration("retryIn", delay))
+			closeBody(resp.Body)
+			return r.retry(config, delay)
+		}
 
-			return r.Request(config)
-		} else {
-			return nil, fmt.Errorf("exceeded max retries HTTP %s, %s", resp.Status, r.Path)
+		if r.failures > 0 {
+			closeBody(resp.Body)
+			return nil, &RestError{
+				Status:    resp.StatusCode,
+				Method:    r.Method,
+				Path:      r.Path,
+				ErrorType: ErrRetriesExceeded,
+				Err:       ErrRetriesExceeded,
+			}
 		}
-	case http.StatusTooManyRequests:
-		// Rate limited
-		var rl *types.RateLimit
-		err = json.NewDecoder(resp.Body).Decode(&rl)
+	}
+
+	return resp, nil
+}
+
+// Waits for delay and then retries the request
+func (r Request[T]) retry(config *RestConfig, delay time.Duration) (*http.Response, error) {
+	time.Sleep(delay)
+
+	// Reacquire the bucket, the route may have been mapped onto a server-assigned bucket
+	r.bucket = nil
+	r.sequence++
+	r.failures++
+
+	return r.Request(config)
+}
+
+// Handles a 429, retrying the request if the retry policy allows it
+func (r Request[T]) handleRatelimit(config *RestConfig, resp *http.Response) (*http.Response, error) {
+	defer closeBody(resp.Body)
+
+	var rl *types.RateLimit
+	err := json.NewDecoder(resp.Body).Decode(&rl)
+	if err != nil {
+		return nil, errors.New("rate limit unmarshal error: " + err.Error())
+	}
+
+	retryAfter := time.Duration(rl.RetryAfter) * time.Millisecond
+
+	if bucket := resp.Header.Get("X-RateLimit-Bucket"); bucket == "" {
+		// Not tied to any bucket, lock all buckets until the ratelimit is over
+		err = config.Ratelimiter.SetGlobalReset(time.Now().Add(retryAfter))
+
 		if err != nil {
-			return nil, errors.New("rate limit unmarshal error: " + err.Error())
+			config.Logger.Error("Failed to set global ratelimit", zap.Error(err))
 		}
 
-		if config.RetryOnRatelimit {
-			config.Logger.Error("Request failed [ratelimited]", zap.String("path", r.Path), zap.String("status", resp.Status), zap.Int64("retryIn", rl.RetryAfter))
-			time.Sleep(time.Duration(rl.RetryAfter)*time.Millisecond + time.Duration(r.sequence)*2*time.Millisecond)
+		r.reportRatelimit(config, RatelimitGlobal, r.bucket.ID(), retryAfter)
+	} else {
+		r.reportRatelimit(config, RatelimitHit, bucket, retryAfter)
+	}
 
-			config.Ratelimiter.LockBucketObject(r.bucket)
-			r.sequence++
+	if delay, ok := r.shouldRetryRatelimit(config.Retry, retryAfter); ok {
+		config.Logger.Error("Request failed [ratelimited]", zap.String("path", r.Path), zap.String("status", resp.Status), zap.Duration("retryIn", delay))
+		time.Sleep(delay)
 
-			return r.Request(config)
-		} else {
-			return nil, errors.New("ratelimited:" + strconv.Itoa(int(rl.RetryAfter)))
-		}
+		// Reacquire the bucket, the route may have been mapped onto a server-assigned bucket
+		r.bucket = nil
+		r.sequence++
+
+		return r.Request(config)
 	}
 
-	return resp, nil
+	return nil, &RestError{
+		Status:    resp.StatusCode,
+		Method:    r.Method,
+		Path:      r.Path,
+		ErrorType: ErrRateLimited,
+		Err:       &RateLimited{RetryAfter: retryAfter},
+	}
 }
 
-// Executes the request and unmarshals the response body if the response is OK otherwise returns error
-func (r Request[T]) With(config *RestConfig) (*T, error) {
-	if len(r.Headers) == 0 {
-		r.Headers = make(map[string]string)
+// Returns a copy of the request with the user agent, default headers and authorization applied
+//
+// Headers set on the request itself take precedence over all others
+func (r Request[T]) prepare(config *RestConfig) Request[T] {
+	headers := map[string]string{
+		"User-Agent": "grevolt/" + version.Version,
+	}
+
+	for k, v := range config.DefaultHeaders {
+		headers[http.CanonicalHeaderKey(k)] = v
 	}
 
+	// Copy the cookies so that the callers slice is never appended to
+	r.Cookies = append([]http.Cookie(nil), r.Cookies...)
+
 	if config.SessionToken != nil {
 		if config.SessionToken.Bot {
-			r.Headers["x-bot-token"] = config.SessionToken.Token
+			headers["X-Bot-Token"] = config.SessionToken.Token
 		} else {
-			r.Headers["x-session-token"] = config.SessionToken.Token
+			headers["X-Session-Token"] = config.SessionToken.Token
+		}
+
+		if config.SessionToken.CfClearance != nil {
+			// The clearance cookie is only valid with the user agent that completed the challenge
+			headers["User-Agent"] = config.SessionToken.CfClearance.UserAgent
+			r.Cookies = append(r.Cookies, http.Cookie{
+				Name:  "cf_clearance",
+				Value: config.SessionToken.CfClearance.CookieValue,
+			})
 		}
 	}
 
-	resp, err := r.Request(config)
+	for k, v := range r.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+
+	r.Headers = headers
+
+	return r
+}
+
+// Executes the request and unmarshals the response body if the response is OK otherwise returns error
+func (r Request[T]) With(config *RestConfig) (*T, error) {
+	resp, err := r.prepare(config).Request(config)
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer closeBody(resp.Body)
+
 	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
 		var v T
 
@@ -195,76 +311,55 @@ func (r Request[T]) With(config *RestConfig) (*T, error) {
 
 		return &v, nil
 	} else {
-		if resp.StatusCode == 401 {
-			// Try and read body
-			body := resp.Body
-
-			if body == nil {
-				return nil, fmt.Errorf("unauthorized")
-			}
-
-			bodyBytes, err := io.ReadAll(body)
-
-			if err != nil {
-				return nil, fmt.Errorf("unauthorized, could not read body")
-			}
-
-			return nil, fmt.Errorf("unauthorized, body: %s", string(bodyBytes))
-		}
-
-		var vErr types.APIError
-		err = json.NewDecoder(resp.Body).Decode(&vErr)
-
-		if err != nil {
-			return nil, err
-		}
-
-		return nil, RestError{APIError: vErr}
+		return nil, r.readError(resp)
 	}
 }
 
 // Discards the content as long as the response is OK otherwise error is returned
 func (r Request[T]) NoContent(config *RestConfig) error {
-	if len(r.Headers) == 0 {
-		r.Headers = make(map[string]string)
-	}
-
-	if config.SessionToken != nil {
-		if config.SessionToken.Bot {
-			r.Headers["x-bot-token"] = config.SessionToken.Token
-		} else {
-			r.Headers["x-session-token"] = config.SessionToken.Token
-		}
-
-		if config.SessionToken.CfClearance != nil {
-			r.Headers["user-agent"] = config.SessionToken.CfClearance.UserAgent
-			r.Cookies = append(r.Cookies, http.Cookie{
-				Name:  "cf_clearance",
-				Value: config.SessionToken.CfClearance.CookieValue,
-			})
-		} else {
-			r.Headers["user-agent"] = "grevolt/" + version.Version
-		}
-	}
-
-	resp, err := r.Request(config)
+	resp, err := r.prepare(config).Request(config)
 
 	if err != nil {
 		return err
 	}
 
+	defer closeBody(resp.Body)
+
 	config.Logger.Debug("Request made", zap.Int("statusCode", resp.StatusCode))
 
 	if resp.StatusCode != 204 && resp.StatusCode != 200 {
-		var vErr types.APIError
-		err = json.NewDecoder(resp.Body).Decode(&vErr)
+		return r.readError(resp)
+	}
+
+	for _, f := range config.OnMarshal {
+		err = f(&RequestData{
+			Method:  r.Method,
+			Path:    r.Path,
+			Json:    r.Json,
+			Headers: r.Headers,
+			Config:  config,
+		}, nil)
 
 		if err != nil {
 			return err
 		}
-
-		return RestError{APIError: vErr}
 	}
 
 	return nil
 }
+
+// Most of a response body that is read before closing it, larger bodies are not worth
+// reading to reuse the connection
+const maxDrain = 64 << 10
+
+// Drains and closes a response body, so its connection is returned to the pool of the
+// http client
+func closeBody(body io.ReadCloser) {
+	// Interceptors may return responses without a body
+	if body == nil {
+		return
+	}
+
+	io.CopyN(io.Discard, body, maxDrain)
+	body.Close()
+}
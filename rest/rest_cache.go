@@ -1,27 +1,162 @@
 package rest
 
-import "github.com/infinitybotlist/grevolt/types"
+import (
+	"strings"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/types"
+	"go.uber.org/zap"
+)
+
+// CacheImpl adds all entities in a response to the shared state, including entities
+// nested in lists and query responses
+//
+// Roles are merged into the roles of their server if the server is cached
+func CacheImpl(r *RequestData, v any) error {
+	s := r.Config.SharedState
 
-func CacheImpl(r *RequestData, v any) {
-	// Doesn't do anything yet
 	switch v := v.(type) {
 	case *types.User:
-		// Add to cache
-		r.Config.SharedState.AddUser(v)
+		return s.AddUser(v)
+	case *types.UserList:
+		return cacheUsers(s, *v)
 	case *types.Emoji:
-		// Add to cache
-		r.Config.SharedState.AddEmoji(v)
+		return s.AddEmoji(v)
 	case *types.Server:
-		// Add to cache
-		r.Config.SharedState.AddServer(v)
+		return s.AddServer(v)
+	case *types.CreateServerResponse:
+		if v.Server != nil {
+			if err := s.AddServer(v.Server); err != nil {
+				return err
+			}
+		}
+
+		return cacheChannels(s, v.Channels)
+	case *types.Channel:
+		return s.AddChannel(v)
+	case *types.ChannelList:
+		return cacheChannels(s, *v)
+	case *types.Member:
+		return cacheMember(s, v)
+	case *types.MemberQueryResponse:
+		for i := range v.Users {
+			if err := s.AddUser(&v.Users[i]); err != nil {
+				return err
+			}
+		}
+
+		for i := range v.Members {
+			if err := cacheMember(s, &v.Members[i]); err != nil {
+				return err
+			}
+		}
+	case *types.MessageFetchResponse:
+		if err := cacheUsers(s, v.Users); err != nil {
+			return err
+		}
+
+		for _, m := range v.Members {
+			if err := cacheMember(s, m); err != nil {
+				return err
+			}
+		}
+	case *types.OwnedBotsResponse:
+		return cacheUsers(s, v.Users)
+	case *types.FetchBotResponse:
+		if v.User != nil {
+			return s.AddUser(v.User)
+		}
+	case *types.NewRoleResponse:
+		// POST servers/{server}/roles
+		if server, ok := pathParam(r.Path, "servers"); ok && v.Role != nil {
+			return s.SetRole(server, v.Id, v.Role)
+		}
+	case *types.Role:
+		// PATCH servers/{server}/roles/{role}
+		server, ok := pathParam(r.Path, "servers")
+		role, rok := pathParam(r.Path, "roles")
+
+		if ok && rok {
+			return s.SetRole(server, role, v)
+		}
 	}
+
+	return nil
 }
 
+// Cacher invalidates entities affected by the request (see Invalidate) and then caches
+// the response in the background (see CacheImpl)
 func Cacher(r *RequestData, v any) error {
-	if r.Config.DisableRestCaching {
+	if r.Config.DisableRestCaching || r.Config.SharedState == nil {
+		return nil
+	}
+
+	if err := Invalidate(r); err != nil {
+		r.Config.Logger.Error("Failed to invalidate cache", zap.String("path", r.Path), zap.Error(err))
+	}
+
+	if v == nil {
 		return nil
 	}
 
-	go CacheImpl(r, v)
+	go func() {
+		if err := CacheImpl(r, v); err != nil {
+			r.Config.Logger.Error("Failed to cache response", zap.String("path", r.Path), zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+func cacheUsers(s *state.State, users []*types.User) error {
+	for _, u := range users {
+		if u == nil {
+			continue
+		}
+
+		if err := s.AddUser(u); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+func cacheChannels(s *state.State, channels []*types.Channel) error {
+	for _, c := range channels {
+		if c == nil {
+			continue
+		}
+
+		if err := s.AddChannel(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Members without an id can't be keyed and are skipped
+func cacheMember(s *state.State, m *types.Member) error {
+	if m == nil || m.Id == nil {
+		return nil
+	}
+
+	return s.AddMember(m)
+}
+
+// Returns the path segment following the given segment, ignoring the query string
+//
+// For example, pathParam("servers/abc/roles", "servers") returns "abc"
+func pathParam(path, segment string) (string, bool) {
+	path, _, _ = strings.Cut(path, "?")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == segment && parts[i+1] != "" {
+			return parts[i+1], true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/cache/store/basicstore"
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+func testState() *state.State {
+	return &state.State{
+		Users:    &basicstore.BasicStore[types.User]{},
+		Servers:  &basicstore.BasicStore[types.Server]{},
+		Channels: &basicstore.BasicStore[types.Channel]{},
+		Members:  &basicstore.BasicStore[types.Member]{},
+		Emojis:   &basicstore.BasicStore[types.Emoji]{},
+	}
+}
+
+func TestCacheImpl(t *testing.T) {
+	s := testState()
+	config := testConfig("https://revolt.example.com/api")
+	config.SharedState = s
+
+	cache := func(path string, v any) {
+		t.Helper()
+
+		if err := CacheImpl(&RequestData{Path: path, Config: config}, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache("channels/c1", &types.Channel{Id: "c1"})
+	cache("users/dms", &types.ChannelList{{Id: "dm1"}, {Id: "dm2"}})
+	cache("servers/s1/members/u1", &types.Member{Id: &types.MemberId{Server: "s1", User: "u1"}})
+	cache("servers/s1/members", &types.MemberQueryResponse{
+		Members: []types.Member{{Id: &types.MemberId{Server: "s1", User: "u2"}}, {}},
+		Users:   []types.User{{Id: "u2"}},
+	})
+	cache("channels/c1/messages", &types.MessageFetchResponse{
+		IncludeUsers: true,
+		Users:        []*types.User{{Id: "u3"}, nil},
+		Members:      []*types.Member{{Id: &types.MemberId{Server: "s1", User: "u3"}}},
+	})
+	cache("servers/create", &types.CreateServerResponse{
+		Server:   &types.Server{Id: "s1", Roles: map[string]*types.Role{"r1": {Name: "old"}}},
+		Channels: []*types.Channel{{Id: "c2"}},
+	})
+	cache("bots/@me", &types.OwnedBotsResponse{Users: []*types.User{{Id: "bot"}}})
+
+	for _, id := range []string{"c1", "c2", "dm1", "dm2"} {
+		if _, err := s.GetChannel(id); err != nil {
+			t.Errorf("channel %s was not cached", id)
+		}
+	}
+
+	for _, id := range []string{"u2", "u3", "bot"} {
+		if _, err := s.GetUser(id); err != nil {
+			t.Errorf("user %s was not cached", id)
+		}
+	}
+
+	for _, id := range []string{"u1", "u2", "u3"} {
+		if _, err := s.GetMember("s1", id); err != nil {
+			t.Errorf("member %s was not cached", id)
+		}
+	}
+
+	// Roles are merged into the cached server
+	cache("servers/s1/roles", &types.NewRoleResponse{Id: "r2", Role: &types.Role{Name: "new"}})
+	cache("servers/s1/roles/r1", &types.Role{Name: "edited"})
+
+	// Roles of servers that are not cached are dropped
+	cache("servers/s2/roles", &types.NewRoleResponse{Id: "r3", Role: &types.Role{Name: "new"}})
+
+	se, err := s.GetServer("s1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(se.Roles) != 2 || se.Roles["r1"].Name != "edited" || se.Roles["r2"].Name != "new" {
+		t.Fatalf("unexpected roles %v", se.Roles)
+	}
+
+	if _, err := s.GetServer("s2"); err == nil {
+		t.Fatal("uncached server was created from a role")
+	}
+}
+
+func TestPathParam(t *testing.T) {
+	tests := []struct {
+		path, segment, want string
+		ok                  bool
+	}{
+		{"servers/abc/roles/def", "servers", "abc", true},
+		{"servers/abc/roles/def", "roles", "def", true},
+		{"servers/abc/roles?x=1", "roles", "", false},
+		{"/servers/abc?x=1", "servers", "abc", true},
+		{"channels/abc", "servers", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := pathParam(tt.path, tt.segment)
+
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("pathParam(%q, %q) = %q, %v; want %q, %v", tt.path, tt.segment, got, ok, tt.want, tt.ok)
+		}
+	}
+}
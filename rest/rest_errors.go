@@ -0,0 +1,305 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// ErrorType is the type of an error returned by the API
+//
+// All error types are sentinel errors, use errors.Is to check for them:
+//
+//	if errors.Is(err, rest.ErrNotFound) {
+//		// ...
+//	}
+type ErrorType string
+
+func (e ErrorType) Error() string {
+	return string(e)
+}
+
+// Error types returned by the API
+const (
+	ErrLabelMe                        ErrorType = "LabelMe"
+	ErrAlreadyOnboarded               ErrorType = "AlreadyOnboarded"
+	ErrUsernameTaken                  ErrorType = "UsernameTaken"
+	ErrInvalidUsername                ErrorType = "InvalidUsername"
+	ErrDiscriminatorChangeRatelimited ErrorType = "DiscriminatorChangeRatelimited"
+	ErrUnknownUser                    ErrorType = "UnknownUser"
+	ErrAlreadyFriends                 ErrorType = "AlreadyFriends"
+	ErrAlreadySentRequest             ErrorType = "AlreadySentRequest"
+	ErrBlocked                        ErrorType = "Blocked"
+	ErrBlockedByOther                 ErrorType = "BlockedByOther"
+	ErrNotFriends                     ErrorType = "NotFriends"
+	ErrUnknownChannel                 ErrorType = "UnknownChannel"
+	ErrUnknownAttachment              ErrorType = "UnknownAttachment"
+	ErrUnknownMessage                 ErrorType = "UnknownMessage"
+	ErrCannotEditMessage              ErrorType = "CannotEditMessage"
+	ErrCannotJoinCall                 ErrorType = "CannotJoinCall"
+	ErrTooManyAttachments             ErrorType = "TooManyAttachments"
+	ErrTooManyReplies                 ErrorType = "TooManyReplies"
+	ErrTooManyChannels                ErrorType = "TooManyChannels"
+	ErrEmptyMessage                   ErrorType = "EmptyMessage"
+	ErrPayloadTooLarge                ErrorType = "PayloadTooLarge"
+	ErrCannotRemoveYourself           ErrorType = "CannotRemoveYourself"
+	ErrGroupTooLarge                  ErrorType = "GroupTooLarge"
+	ErrAlreadyInGroup                 ErrorType = "AlreadyInGroup"
+	ErrNotInGroup                     ErrorType = "NotInGroup"
+	ErrUnknownServer                  ErrorType = "UnknownServer"
+	ErrInvalidRole                    ErrorType = "InvalidRole"
+	ErrBanned                         ErrorType = "Banned"
+	ErrTooManyServers                 ErrorType = "TooManyServers"
+	ErrTooManyEmoji                   ErrorType = "TooManyEmoji"
+	ErrTooManyRoles                   ErrorType = "TooManyRoles"
+	ErrReachedMaximumBots             ErrorType = "ReachedMaximumBots"
+	ErrIsBot                          ErrorType = "IsBot"
+	ErrBotIsPrivate                   ErrorType = "BotIsPrivate"
+	ErrCannotReportYourself           ErrorType = "CannotReportYourself"
+	ErrMissingPermission              ErrorType = "MissingPermission"
+	ErrMissingUserPermission          ErrorType = "MissingUserPermission"
+	ErrNotElevated                    ErrorType = "NotElevated"
+	ErrNotPrivileged                  ErrorType = "NotPrivileged"
+	ErrCannotGiveMissingPermissions   ErrorType = "CannotGiveMissingPermissions"
+	ErrNotOwner                       ErrorType = "NotOwner"
+	ErrDatabaseError                  ErrorType = "DatabaseError"
+	ErrInternalError                  ErrorType = "InternalError"
+	ErrInvalidOperation               ErrorType = "InvalidOperation"
+	ErrInvalidCredentials             ErrorType = "InvalidCredentials"
+	ErrInvalidProperty                ErrorType = "InvalidProperty"
+	ErrInvalidSession                 ErrorType = "InvalidSession"
+	ErrDuplicateNonce                 ErrorType = "DuplicateNonce"
+	ErrVosoUnavailable                ErrorType = "VosoUnavailable"
+	ErrNotFound                       ErrorType = "NotFound"
+	ErrNoEffect                       ErrorType = "NoEffect"
+	ErrFailedValidation               ErrorType = "FailedValidation"
+)
+
+// Error types not returned by the API itself
+const (
+	// The request was ratelimited and the retry policy does not allow retrying it, see RateLimited
+	ErrRateLimited ErrorType = "RateLimited"
+
+	// The request failed with a 401 without an error type in the body
+	ErrUnauthorized ErrorType = "Unauthorized"
+
+	// The request kept failing with a 502, 503 or 504 until the retry policy gave up
+	ErrRetriesExceeded ErrorType = "RetriesExceeded"
+
+	// The API returned an error without a (known) type
+	ErrUnknown ErrorType = "Unknown"
+)
+
+// MissingPermission is returned when the bot lacks a permission in a server or channel
+type MissingPermission struct {
+	// The permission that is missing
+	Permission string `json:"permission"`
+}
+
+func (e *MissingPermission) Error() string {
+	return "missing permission: " + e.Permission
+}
+
+func (e *MissingPermission) Is(target error) bool {
+	return target == ErrMissingPermission
+}
+
+// MissingUserPermission is returned when the bot lacks a permission on a user
+type MissingUserPermission struct {
+	// The permission that is missing
+	Permission string `json:"permission"`
+}
+
+func (e *MissingUserPermission) Error() string {
+	return "missing user permission: " + e.Permission
+}
+
+func (e *MissingUserPermission) Is(target error) bool {
+	return target == ErrMissingUserPermission
+}
+
+// LimitExceeded is returned when a limit of the instance is exceeded, such as
+// TooManyAttachments or GroupTooLarge
+type LimitExceeded struct {
+	// The type of the error
+	Type ErrorType `json:"type"`
+
+	// The limit that was exceeded
+	Max int `json:"max"`
+}
+
+func (e *LimitExceeded) Error() string {
+	return fmt.Sprintf("%s (max %d)", e.Type, e.Max)
+}
+
+func (e *LimitExceeded) Is(target error) bool {
+	return target == e.Type
+}
+
+// TooManyAttachments is returned when a message has more attachments than allowed
+//
+// Other limits are only available as LimitExceeded, use LimitExceeded.Type to tell
+// them apart. A TooManyAttachments error also matches *LimitExceeded in errors.As
+type TooManyAttachments struct {
+	LimitExceeded
+}
+
+func (e *TooManyAttachments) As(target any) bool {
+	if t, ok := target.(**LimitExceeded); ok {
+		*t = &e.LimitExceeded
+		return true
+	}
+
+	return false
+}
+
+// FailedValidation is returned when the request body fails validation
+type FailedValidation struct {
+	// The validation error
+	Err string `json:"error"`
+}
+
+func (e *FailedValidation) Error() string {
+	return "failed validation: " + e.Err
+}
+
+func (e *FailedValidation) Is(target error) bool {
+	return target == ErrFailedValidation
+}
+
+// DatabaseError is returned when the API fails to perform a database operation
+type DatabaseError struct {
+	Operation  string `json:"operation"`
+	Collection string `json:"collection"`
+}
+
+func (e *DatabaseError) Error() string {
+	return "database error: " + e.Operation + " on " + e.Collection
+}
+
+func (e *DatabaseError) Is(target error) bool {
+	return target == ErrDatabaseError
+}
+
+// RateLimited is returned when a request is ratelimited and the retry policy does not allow retrying it
+type RateLimited struct {
+	// How long to wait before retrying the request
+	RetryAfter time.Duration
+}
+
+func (e *RateLimited) Error() string {
+	return "ratelimited, retry after " + e.RetryAfter.String()
+}
+
+func (e *RateLimited) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RestError is returned by all requests that fail with a non-2xx status
+//
+// The typed error can be accessed using errors.As (such as *MissingPermission) and
+// the type of the error using errors.Is (such as ErrNotFound)
+type RestError struct {
+	// The raw error returned by the API, if any
+	types.APIError
+
+	// HTTP status code of the response
+	Status int
+
+	// Method of the request
+	Method Method
+
+	// Path of the request
+	Path string
+
+	// The type of the error
+	ErrorType ErrorType
+
+	// The typed error, this is the ErrorType itself if the error type has no fields
+	Err error
+}
+
+func (r *RestError) Error() string {
+	return fmt.Sprintf("API Error: %s %s: HTTP %d: %s", r.Method, r.Path, r.Status, r.Err)
+}
+
+func (r *RestError) Unwrap() error {
+	return r.Err
+}
+
+// Returns the type of the error, this overrides types.APIError.Type
+func (r *RestError) Type() string {
+	return string(r.ErrorType)
+}
+
+// Creates the typed error for an error returned by the API
+func parseAPIError(status int, body []byte) (types.APIError, ErrorType, error) {
+	var apiErr types.APIError
+
+	if len(body) == 0 || json.Unmarshal(body, &apiErr) != nil || apiErr.Type() == "Unknown" {
+		switch status {
+		case http.StatusUnauthorized:
+			return apiErr, ErrUnauthorized, ErrUnauthorized
+		case http.StatusNotFound:
+			return apiErr, ErrNotFound, ErrNotFound
+		default:
+			return apiErr, ErrUnknown, ErrUnknown
+		}
+	}
+
+	typ := ErrorType(apiErr.Type())
+
+	var typed error
+	switch typ {
+	case ErrMissingPermission:
+		typed = &MissingPermission{}
+	case ErrMissingUserPermission:
+		typed = &MissingUserPermission{}
+	case ErrTooManyAttachments:
+		typed = &TooManyAttachments{LimitExceeded{Type: typ}}
+	case ErrTooManyReplies, ErrTooManyChannels, ErrGroupTooLarge, ErrTooManyServers, ErrTooManyEmoji, ErrTooManyRoles:
+		typed = &LimitExceeded{Type: typ}
+	case ErrFailedValidation:
+		typed = &FailedValidation{}
+	case ErrDatabaseError:
+		typed = &DatabaseError{}
+	default:
+		return apiErr, typ, typ
+	}
+
+	if err := json.Unmarshal(body, typed); err != nil {
+		return apiErr, typ, typ
+	}
+
+	return apiErr, typ, typed
+}
+
+// Reads the error from a failed response
+func (r Request[T]) readError(resp *http.Response) error {
+	var body []byte
+	if resp.Body != nil {
+		defer resp.Body.Close()
+
+		var err error
+		body, err = io.ReadAll(resp.Body)
+
+		if err != nil {
+			return fmt.Errorf("failed to read error body: %w", err)
+		}
+	}
+
+	apiErr, typ, typed := parseAPIError(resp.StatusCode, body)
+
+	return &RestError{
+		APIError:  apiErr,
+		Status:    resp.StatusCode,
+		Method:    r.Method,
+		Path:      r.Path,
+		ErrorType: typ,
+		Err:       typed,
+	}
+}
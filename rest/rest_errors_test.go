@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func errorResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestReadError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		is     error
+	}{
+		{"not found", 404, `{"type":"NotFound"}`, ErrNotFound},
+		{"not found without body", 404, ``, ErrNotFound},
+		{"banned", 403, `{"type":"Banned"}`, ErrBanned},
+		{"invalid session", 401, `{"type":"InvalidSession"}`, ErrInvalidSession},
+		{"unauthorized", 401, `Unauthorized`, ErrUnauthorized},
+		{"missing permission", 403, `{"type":"MissingPermission","permission":"SendMessage"}`, ErrMissingPermission},
+		{"too many attachments", 400, `{"type":"TooManyAttachments","max":5}`, ErrTooManyAttachments},
+		{"unknown", 500, `{}`, ErrUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Request[any]{Method: POST, Path: "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages"}
+			err := r.readError(errorResponse(tt.status, tt.body))
+
+			if !errors.Is(err, tt.is) {
+				t.Fatalf("expected errors.Is(%v, %v)", err, tt.is)
+			}
+
+			var restErr *RestError
+			if !errors.As(err, &restErr) {
+				t.Fatalf("expected *RestError, got %T", err)
+			}
+
+			if restErr.Status != tt.status || restErr.Path != r.Path || restErr.Method != r.Method {
+				t.Errorf("unexpected request info: %d %s %s", restErr.Status, restErr.Method, restErr.Path)
+			}
+
+			if restErr.Type() != tt.is.Error() {
+				t.Errorf("Type() = %q, want %q", restErr.Type(), tt.is.Error())
+			}
+		})
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	r := Request[any]{Path: "servers/01G11DTVYAJNCD2JH2Q1TKKHAR"}
+
+	err := r.readError(errorResponse(403, `{"type":"MissingPermission","permission":"ManageServer"}`))
+
+	var perm *MissingPermission
+	if !errors.As(err, &perm) || perm.Permission != "ManageServer" {
+		t.Fatalf("expected *MissingPermission{ManageServer}, got %v", err)
+	}
+
+	err = r.readError(errorResponse(400, `{"type":"TooManyAttachments","max":5}`))
+
+	var limit *TooManyAttachments
+	if !errors.As(err, &limit) || limit.Max != 5 {
+		t.Fatalf("expected *TooManyAttachments{5}, got %v", err)
+	}
+
+	if errors.Is(err, ErrTooManyReplies) {
+		t.Fatal("TooManyAttachments must not match other limits")
+	}
+
+	var anyLimit *LimitExceeded
+	if !errors.As(err, &anyLimit) || anyLimit.Type != ErrTooManyAttachments || anyLimit.Max != 5 {
+		t.Fatalf("expected TooManyAttachments to match *LimitExceeded, got %v", err)
+	}
+
+	err = r.readError(errorResponse(400, `{"type":"TooManyReplies","max":5}`))
+
+	if errors.As(err, &limit) {
+		t.Fatal("TooManyReplies must not match *TooManyAttachments")
+	}
+
+	if !errors.As(err, &anyLimit) || anyLimit.Type != ErrTooManyReplies {
+		t.Fatalf("expected *LimitExceeded{TooManyReplies}, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// An outgoing request as seen by interceptors
+type InterceptedRequest struct {
+	// Method of the request
+	Method Method
+
+	// Path of the request, relative to the API url
+	Path string
+
+	// The HTTP request, interceptors may modify its headers and cookies
+	Request *http.Request
+
+	// Body of the request, interceptors may replace this to modify the body
+	Body []byte
+
+	// How many times this request has been retried, 0 for the first attempt
+	Retry int
+
+	// Config of the client making the request
+	Config *RestConfig
+}
+
+// Sends an intercepted request, returning its response
+type RoundTrip func(req *InterceptedRequest) (*http.Response, error)
+
+// An interceptor wraps every HTTP attempt made by the rest client (including retries)
+//
+// Interceptors are run in the order they were added. An interceptor must call next to
+// send the request, it may also return a response or error without calling next
+// (for example, to inject faults in tests). The ratelimit bucket of the request is
+// held for the whole chain and updated from the returned response.
+type Interceptor func(req *InterceptedRequest, next RoundTrip) (*http.Response, error)
+
+// Runs the interceptor chain, sending the request with final once the chain completes
+func runInterceptors(interceptors []Interceptor, req *InterceptedRequest, final RoundTrip) (*http.Response, error) {
+	var run func(i int) RoundTrip
+	run = func(i int) RoundTrip {
+		if i >= len(interceptors) {
+			return final
+		}
+
+		return func(req *InterceptedRequest) (*http.Response, error) {
+			return interceptors[i](req, run(i+1))
+		}
+	}
+
+	return run(0)(req)
+}
+
+// Sends the request using the configs http client, this is the end of the interceptor chain
+func send(req *InterceptedRequest) (*http.Response, error) {
+	// The body may have been replaced by an interceptor
+	req.Request.Body = io.NopCloser(bytes.NewReader(req.Body))
+	req.Request.ContentLength = int64(len(req.Body))
+	req.Request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(req.Body)), nil
+	}
+
+	client := req.Config.HTTPClient
+
+	if client == nil {
+		client = &http.Client{Timeout: req.Config.Timeout}
+	}
+
+	return client.Do(req.Request)
+}
+
+// LogRequests returns an interceptor that logs every request, its status and latency
+func LogRequests(logger *zap.Logger) Interceptor {
+	return func(req *InterceptedRequest, next RoundTrip) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(req)
+
+		fields := []zap.Field{
+			zap.String("method", string(req.Method)),
+			zap.String("path", req.Path),
+			zap.Int("retry", req.Retry),
+			zap.Duration("latency", time.Since(start)),
+		}
+
+		if err != nil {
+			logger.Error("Request failed", append(fields, zap.Error(err))...)
+			return resp, err
+		}
+
+		logger.Info("Request", append(fields, zap.Int("status", resp.StatusCode))...)
+		return resp, nil
+	}
+}
@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+
+		if r.Header.Get("X-Signature") != "signed" {
+			t.Errorf("request was not signed")
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"content":"modified"}` {
+			t.Errorf("unexpected body %s", body)
+		}
+
+		if attempts == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"retry_after":1}`))
+			return
+		}
+
+		w.Write([]byte(`{"content":"ok"}`))
+	}))
+	defer srv.Close()
+
+	config := testConfig(srv.URL)
+
+	var order []string
+	var retries []int
+	var statuses []int
+
+	config.Interceptors = []Interceptor{
+		func(req *InterceptedRequest, next RoundTrip) (*http.Response, error) {
+			order = append(order, "first")
+			retries = append(retries, req.Retry)
+
+			resp, err := next(req)
+
+			if err == nil {
+				statuses = append(statuses, resp.StatusCode)
+			}
+
+			return resp, err
+		},
+		func(req *InterceptedRequest, next RoundTrip) (*http.Response, error) {
+			order = append(order, "second")
+
+			req.Request.Header.Set("X-Signature", "signed")
+			req.Body = []byte(`{"content":"modified"}`)
+
+			return next(req)
+		},
+	}
+
+	config.Retry.RetryRatelimits = true
+
+	res, err := Request[map[string]string]{
+		Method: POST,
+		Path:   "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages",
+		Json:   map[string]string{"content": "original"},
+	}.With(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (*res)["content"] != "ok" {
+		t.Fatalf("unexpected response %v", *res)
+	}
+
+	if strings.Join(order, ",") != "first,second,first,second" {
+		t.Errorf("unexpected order %v", order)
+	}
+
+	if len(retries) != 2 || retries[0] != 0 || retries[1] != 1 {
+		t.Errorf("unexpected retries %v", retries)
+	}
+
+	if len(statuses) != 2 || statuses[0] != http.StatusTooManyRequests || statuses[1] != http.StatusOK {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	config := testConfig("http://127.0.0.1:0")
+
+	config.Interceptors = []Interceptor{
+		func(req *InterceptedRequest, next RoundTrip) (*http.Response, error) {
+			// Inject a fault without sending the request
+			return &http.Response{
+				StatusCode: http.StatusNotFound,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(`{"type":"NotFound"}`)),
+			}, nil
+		},
+	}
+
+	err := Request[any]{Method: DELETE, Path: "channels/01G11DTVYAJQCJJ9VZMA6GRND3"}.NoContent(config)
+
+	if err == nil || err.(*RestError).ErrorType != ErrNotFound {
+		t.Fatalf("expected injected NotFound, got %v", err)
+	}
+}
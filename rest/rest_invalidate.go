@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// Invalidate evicts or updates cached entities affected by a successful mutation
+//
+// Leaving or deleting a server also evicts its cached channels and members, see
+// state.State.PurgeServer
+func Invalidate(r *RequestData) error {
+	s := r.Config.SharedState
+	path, _, _ := strings.Cut(r.Path, "?")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch r.Method {
+	case DELETE:
+		switch {
+		case matchRoute(parts, "channels", "*"):
+			return invalidateChannel(s, parts[1])
+		case matchRoute(parts, "channels", "*", "recipients", "*"):
+			return s.RemoveRecipient(parts[1], parts[3])
+		case matchRoute(parts, "servers", "*"):
+			return s.PurgeServer(parts[1])
+		case matchRoute(parts, "servers", "*", "members", "*"):
+			return ignoreNotFound(s.DeleteMember(parts[1], parts[3]))
+		case matchRoute(parts, "servers", "*", "roles", "*"):
+			return s.RemoveRole(parts[1], parts[3])
+		case matchRoute(parts, "bots", "*"):
+			// Bots share their id with their user
+			return ignoreNotFound(s.DeleteUser(parts[1]))
+		}
+	case PUT:
+		if matchRoute(parts, "servers", "*", "bans", "*") {
+			return ignoreNotFound(s.DeleteMember(parts[1], parts[3]))
+		}
+	}
+
+	return nil
+}
+
+// Returns whether the path segments match the route, "*" matches any segment
+func matchRoute(parts []string, route ...string) bool {
+	if len(parts) != len(route) {
+		return false
+	}
+
+	for i, seg := range route {
+		if parts[i] == "" || (seg != "*" && seg != parts[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ignoreNotFound(err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// Closing a direct message only marks it inactive, other channels are evicted and
+// removed from their server
+func invalidateChannel(s *state.State, id string) error {
+	c, err := s.GetChannel(id)
+
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	if c.ChannelType == types.DIRECTMESSAGE_ChannelType {
+		newChan := *c
+		newChan.Active = false
+		return s.AddChannel(&newChan)
+	}
+
+	return s.RemoveChannel(id)
+}
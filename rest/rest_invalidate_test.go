@@ -0,0 +1,159 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// Returns a state with server s1 containing channels c1 and c2, role r1 and members u1 and u2
+func invalidateState(t *testing.T) *state.State {
+	t.Helper()
+
+	s := testState()
+
+	s.AddServer(&types.Server{
+		Id:       "s1",
+		Channels: []string{"c1", "c2"},
+		Roles:    map[string]*types.Role{"r1": {Name: "mod"}, "r2": {Name: "admin"}},
+	})
+	s.AddServer(&types.Server{Id: "s2", Channels: []string{"c3"}})
+	s.AddChannel(&types.Channel{Id: "c1", ChannelType: types.TEXTCHANNEL_ChannelType, Server: "s1"})
+	s.AddChannel(&types.Channel{Id: "c2", ChannelType: types.VOICECHANNEL_ChannelType, Server: "s1"})
+	s.AddChannel(&types.Channel{Id: "c3", ChannelType: types.TEXTCHANNEL_ChannelType, Server: "s2"})
+	s.AddChannel(&types.Channel{Id: "dm", ChannelType: types.DIRECTMESSAGE_ChannelType, Active: true})
+	s.AddChannel(&types.Channel{Id: "group", ChannelType: types.GROUP_ChannelType, Recipients: []string{"u1", "u2"}})
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: "s1", User: "u1"}, Roles: []string{"r1", "r2"}})
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: "s1", User: "u2"}})
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: "s2", User: "u1"}})
+	s.AddUser(&types.User{Id: "bot"})
+
+	return s
+}
+
+func TestInvalidate(t *testing.T) {
+	s := invalidateState(t)
+	config := testConfig("https://revolt.example.com/api")
+	config.SharedState = s
+
+	invalidate := func(method Method, path string) {
+		t.Helper()
+
+		if err := Invalidate(&RequestData{Method: method, Path: path, Config: config}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invalidate(DELETE, "channels/c2?leave_silently=false")
+
+	if _, err := s.GetChannel("c2"); err == nil {
+		t.Error("deleted channel is still cached")
+	}
+
+	if se, _ := s.GetServer("s1"); len(se.Channels) != 1 || se.Channels[0] != "c1" {
+		t.Errorf("deleted channel was not removed from its server: %v", se.Channels)
+	}
+
+	invalidate(DELETE, "channels/dm?leave_silently=false")
+
+	if c, err := s.GetChannel("dm"); err != nil || c.Active {
+		t.Error("closed direct message should be cached as inactive")
+	}
+
+	invalidate(DELETE, "/channels/group/recipients/u1")
+
+	if c, _ := s.GetChannel("group"); len(c.Recipients) != 1 || c.Recipients[0] != "u2" {
+		t.Errorf("recipient was not removed: %v", c.Recipients)
+	}
+
+	invalidate(DELETE, "servers/s1/roles/r1")
+
+	if se, _ := s.GetServer("s1"); len(se.Roles) != 1 || se.Roles["r2"] == nil {
+		t.Errorf("deleted role is still cached: %v", se.Roles)
+	}
+
+	if m, _ := s.GetMember("s1", "u1"); len(m.Roles) != 1 || m.Roles[0] != "r2" {
+		t.Errorf("deleted role was not removed from member: %v", m.Roles)
+	}
+
+	invalidate(DELETE, "servers/s1/members/u1")
+
+	if _, err := s.GetMember("s1", "u1"); err == nil {
+		t.Error("kicked member is still cached")
+	}
+
+	invalidate(PUT, "servers/s1/bans/u2")
+
+	if _, err := s.GetMember("s1", "u2"); err == nil {
+		t.Error("banned member is still cached")
+	}
+
+	invalidate(DELETE, "bots/bot")
+
+	if _, err := s.GetUser("bot"); err == nil {
+		t.Error("deleted bot is still cached")
+	}
+
+	// Leaving a server that isn't cached is a no-op
+	invalidate(DELETE, "servers/unknown")
+
+	invalidate(DELETE, "servers/s2?leave_silently=true")
+
+	if _, err := s.GetServer("s2"); err == nil {
+		t.Error("left server is still cached")
+	}
+
+	if _, err := s.GetChannel("c3"); err == nil {
+		t.Error("channel of left server is still cached")
+	}
+
+	if _, err := s.GetMember("s2", "u1"); err == nil {
+		t.Error("member of left server is still cached")
+	}
+
+	if _, err := s.GetChannel("c1"); err != nil {
+		t.Error("channel of another server was evicted")
+	}
+}
+
+func TestInvalidateNoContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/servers/s1/members/u2" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"type":"MissingPermission","permission":"KickMembers"}`))
+	}))
+	defer srv.Close()
+
+	s := invalidateState(t)
+	config := testConfig(srv.URL)
+	config.SharedState = s
+	config.OnMarshal = []func(r *RequestData, v any) error{Cacher}
+
+	// Failed mutations leave the cache alone
+	err := Request[types.APIError]{Method: DELETE, Path: "servers/s1/members/u1"}.NoContent(config)
+
+	if err == nil {
+		t.Fatal("expected kick to fail")
+	}
+
+	if _, err := s.GetMember("s1", "u1"); err != nil {
+		t.Fatal("member was evicted after a failed kick")
+	}
+
+	err = Request[types.APIError]{Method: DELETE, Path: "servers/s1/members/u2"}.NoContent(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetMember("s1", "u2"); err == nil {
+		t.Fatal("kicked member is still cached")
+	}
+}
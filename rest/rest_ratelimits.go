@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
+	"go.uber.org/zap"
+)
+
+// The kind of a ratelimit event
+type RatelimitKind string
+
+const (
+	// The request was ratelimited by the API (HTTP 429)
+	RatelimitHit RatelimitKind = "hit"
+
+	// The request waited for its bucket before being sent
+	RatelimitWait RatelimitKind = "wait"
+
+	// The request was ratelimited by a global ratelimit, locking all buckets
+	RatelimitGlobal RatelimitKind = "global"
+)
+
+// Requests waiting less than this for their bucket are not reported
+const minReportedWait = 5 * time.Millisecond
+
+// A ratelimit event, passed to RestConfig.OnRatelimit
+type RatelimitEvent struct {
+	// The kind of the event
+	Kind RatelimitKind
+
+	// Method of the request
+	Method Method
+
+	// Path of the request
+	Path string
+
+	// Route of the request, with IDs replaced (see ratelimits.Route)
+	Route string
+
+	// The ratelimit bucket of the request
+	Bucket string
+
+	// How long the request waited (RatelimitWait) or has to wait (RatelimitHit, RatelimitGlobal)
+	Wait time.Duration
+
+	// Whether the ratelimit applies to all buckets
+	Global bool
+}
+
+// Counters of ratelimit events for a route
+type RatelimitCount struct {
+	// Number of 429s
+	Hits uint64
+
+	// Number of global ratelimits
+	Global uint64
+
+	// Number of requests that waited for their bucket
+	Waits uint64
+
+	// Total time spent waiting for buckets
+	WaitTime time.Duration
+}
+
+// RatelimitStats counts ratelimit events per route
+type RatelimitStats struct {
+	mu     sync.Mutex
+	routes map[string]RatelimitCount
+}
+
+// NewRatelimitStats returns a new empty RatelimitStats
+func NewRatelimitStats() *RatelimitStats {
+	return &RatelimitStats{
+		routes: make(map[string]RatelimitCount),
+	}
+}
+
+// Record adds an event to the counters
+func (s *RatelimitStats) Record(e *RatelimitEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.routes == nil {
+		s.routes = make(map[string]RatelimitCount)
+	}
+
+	c := s.routes[e.Route]
+
+	switch e.Kind {
+	case RatelimitHit:
+		c.Hits++
+	case RatelimitGlobal:
+		c.Global++
+	case RatelimitWait:
+		c.Waits++
+		c.WaitTime += e.Wait
+	}
+
+	s.routes[e.Route] = c
+}
+
+// Routes returns a copy of the counters of every route
+func (s *RatelimitStats) Routes() map[string]RatelimitCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	routes := make(map[string]RatelimitCount, len(s.routes))
+	for k, v := range s.routes {
+		routes[k] = v
+	}
+
+	return routes
+}
+
+// Total returns the sum of the counters of every route
+func (s *RatelimitStats) Total() RatelimitCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var t RatelimitCount
+	for _, c := range s.routes {
+		t.Hits += c.Hits
+		t.Global += c.Global
+		t.Waits += c.Waits
+		t.WaitTime += c.WaitTime
+	}
+
+	return t
+}
+
+// Reports a ratelimit event to the stats, OnRatelimit and the logger
+func (r Request[T]) reportRatelimit(config *RestConfig, kind RatelimitKind, bucket string, wait time.Duration) {
+	e := &RatelimitEvent{
+		Kind:   kind,
+		Method: r.Method,
+		Path:   r.Path,
+		Route:  ratelimits.Route(string(r.Method), r.Path),
+		Bucket: bucket,
+		Wait:   wait,
+		Global: kind == RatelimitGlobal,
+	}
+
+	config.Logger.Debug(
+		"Ratelimited",
+		zap.String("kind", string(e.Kind)),
+		zap.String("route", e.Route),
+		zap.String("bucket", e.Bucket),
+		zap.Duration("wait", e.Wait),
+	)
+
+	if config.RatelimitStats != nil {
+		config.RatelimitStats.Record(e)
+	}
+
+	if config.OnRatelimit != nil {
+		config.OnRatelimit(e)
+	}
+}
@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestOnRatelimit(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+
+		switch attempts {
+		case 1:
+			w.Header().Set("X-RateLimit-Bucket", "messages")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"retry_after":10}`))
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"retry_after":10}`))
+		case 3:
+			// Exhaust the bucket, the next request must wait for it
+			w.Header().Set("X-RateLimit-Bucket", "messages")
+			w.Header().Set("X-RateLimit-Limit", "10")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset-After", "50")
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	config := testConfig(srv.URL)
+	config.Retry.RetryRatelimits = true
+	config.RatelimitStats = NewRatelimitStats()
+
+	var mu sync.Mutex
+	var events []RatelimitEvent
+	config.OnRatelimit = func(e *RatelimitEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, *e)
+	}
+
+	path := "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages"
+
+	for i := 0; i < 2; i++ {
+		_, err := Request[map[string]any]{Method: POST, Path: path}.With(config)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wantKinds := []RatelimitKind{RatelimitHit, RatelimitGlobal, RatelimitWait}
+
+	if len(events) != len(wantKinds) {
+		t.Fatalf("expected %d events, got %v", len(wantKinds), events)
+	}
+
+	for i, kind := range wantKinds {
+		e := events[i]
+
+		if e.Kind != kind {
+			t.Errorf("event %d: kind = %s, want %s", i, e.Kind, kind)
+		}
+
+		if e.Route != "POST:channels/:id/messages" || e.Path != path || e.Method != POST {
+			t.Errorf("event %d: unexpected request info %+v", i, e)
+		}
+
+		if e.Wait <= 0 {
+			t.Errorf("event %d: expected a wait time", i)
+		}
+	}
+
+	if events[0].Bucket != "messages" || events[0].Global {
+		t.Errorf("unexpected hit event %+v", events[0])
+	}
+
+	if !events[1].Global {
+		t.Errorf("expected global event %+v", events[1])
+	}
+
+	c := config.RatelimitStats.Routes()["POST:channels/:id/messages"]
+
+	if c.Hits != 1 || c.Global != 1 || c.Waits != 1 || c.WaitTime <= 0 {
+		t.Errorf("unexpected counters %+v", c)
+	}
+
+	if config.RatelimitStats.Total() != c {
+		t.Errorf("unexpected total %+v", config.RatelimitStats.Total())
+	}
+}
@@ -0,0 +1,153 @@
+package rest
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// RetryPolicy decides which failed requests are retried and how long to wait between attempts
+//
+// A nil or zero RetryPolicy never retries
+type RetryPolicy struct {
+	// Maximum number of retries after the first attempt, ratelimited requests
+	// are not counted towards this
+	MaxRetries int
+
+	// HTTP statuses that are retried
+	Statuses []int
+
+	// Whether requests that failed without a response (such as a timeout) are retried
+	RetryNetworkErrors bool
+
+	// Methods that are safe to retry
+	//
+	// Requests using other methods are only retried if they are idempotent, that is
+	// they have an Idempotency-Key header or send a message with a nonce
+	Methods []Method
+
+	// Whether ratelimited requests are retried once the ratelimit resets
+	RetryRatelimits bool
+
+	// Delay before the first retry, doubled for every retry after it
+	BaseDelay time.Duration
+
+	// Maximum delay between retries
+	MaxDelay time.Duration
+
+	// Fraction of the delay that is randomized (0-1) so that clients don't retry in lockstep
+	Jitter float64
+
+	// No retries are made once this much time has passed since the first attempt, 0 means no limit
+	MaxElapsed time.Duration
+}
+
+// DefaultRetryPolicy returns the default retry policy
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:         3,
+		Statuses:           []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		RetryNetworkErrors: true,
+		Methods:            []Method{GET, HEAD, OPTIONS, PUT, DELETE},
+		RetryRatelimits:    true,
+		BaseDelay:          200 * time.Millisecond,
+		MaxDelay:           10 * time.Second,
+		Jitter:             0.2,
+		MaxElapsed:         time.Minute,
+	}
+}
+
+// Idempotent returns whether a request can be safely retried
+func (p *RetryPolicy) Idempotent(method Method, headers map[string]string, json any) bool {
+	for _, m := range p.Methods {
+		if m == method {
+			return true
+		}
+	}
+
+	for k := range headers {
+		if http.CanonicalHeaderKey(k) == "Idempotency-Key" {
+			return true
+		}
+	}
+
+	// Revolt won't send a message twice if the nonce is the same
+	if d, ok := json.(*types.DataMessageSend); ok && d != nil && d.Nonce != "" {
+		return true
+	}
+
+	return false
+}
+
+// RetryStatus returns whether a response status should be retried
+func (p *RetryPolicy) RetryStatus(status int) bool {
+	for _, s := range p.Statuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Backoff returns the delay before the given retry (starting at 0)
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	d := p.BaseDelay
+
+	for i := 0; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+
+	return d
+}
+
+// Returns whether the deadline of the policy allows waiting delay before retrying
+func (p *RetryPolicy) withinDeadline(started time.Time, delay time.Duration) bool {
+	return p.MaxElapsed <= 0 || time.Since(started)+delay <= p.MaxElapsed
+}
+
+// Returns the delay before retrying a failed request, or false if it should not be retried
+//
+// Only failures count towards MaxRetries and the backoff, ratelimited attempts do not
+func (r Request[T]) shouldRetry(p *RetryPolicy) (time.Duration, bool) {
+	if p == nil || r.failures >= p.MaxRetries || !p.Idempotent(r.Method, r.Headers, r.Json) {
+		return 0, false
+	}
+
+	delay := p.Backoff(r.failures)
+
+	if !p.withinDeadline(r.started, delay) {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// Returns the delay before retrying a ratelimited request, or false if it should not be retried
+func (r Request[T]) shouldRetryRatelimit(p *RetryPolicy, retryAfter time.Duration) (time.Duration, bool) {
+	if p == nil || !p.RetryRatelimits {
+		return 0, false
+	}
+
+	delay := retryAfter
+	if p.Jitter > 0 && p.BaseDelay > 0 {
+		// Only ever wait longer than the ratelimit
+		delay += time.Duration(rand.Float64() * p.Jitter * float64(p.BaseDelay))
+	}
+
+	if !p.withinDeadline(r.started, delay) {
+		return 0, false
+	}
+
+	return delay, true
+}
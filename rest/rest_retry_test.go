@@ -0,0 +1,201 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// Starts a server failing with status until fails requests have been made
+func failingServer(t *testing.T, status int, fails int32, attempts *int32) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(attempts, 1) <= fails {
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Write([]byte(`{}`))
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func fastRetryPolicy() *RetryPolicy {
+	p := DefaultRetryPolicy()
+	p.BaseDelay = time.Millisecond
+	return p
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	var attempts int32
+	srv := failingServer(t, http.StatusBadGateway, 2, &attempts)
+
+	config := testConfig(srv.URL)
+	config.Retry = fastRetryPolicy()
+
+	_, err := Request[map[string]any]{Method: GET, Path: "users/@me"}.With(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestNoRetryNonIdempotent(t *testing.T) {
+	var attempts int32
+	srv := failingServer(t, http.StatusBadGateway, 1, &attempts)
+
+	config := testConfig(srv.URL)
+	config.Retry = fastRetryPolicy()
+
+	_, err := Request[map[string]any]{
+		Method: POST,
+		Path:   "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages",
+		Json:   &types.DataMessageSend{Content: "hello"},
+	}.With(config)
+
+	var restErr *RestError
+	if !errors.As(err, &restErr) || restErr.Status != http.StatusBadGateway {
+		t.Fatalf("expected HTTP 502 error, got %v", err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetryNonce(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Idempotency-Key") != "01H3SPT5VV7J5XQ5615WJXHJC2" {
+			t.Errorf("expected Idempotency-Key header, got %q", r.Header.Get("Idempotency-Key"))
+		}
+
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	config := testConfig(srv.URL)
+	config.Retry = fastRetryPolicy()
+
+	_, err := Request[map[string]any]{
+		Method: POST,
+		Path:   "channels/01G11DTVYAJQCJJ9VZMA6GRND3/messages",
+		Json:   &types.DataMessageSend{Content: "hello", Nonce: "01H3SPT5VV7J5XQ5615WJXHJC2"},
+	}.With(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRetriesExceeded(t *testing.T) {
+	var attempts int32
+	srv := failingServer(t, http.StatusGatewayTimeout, 100, &attempts)
+
+	config := testConfig(srv.URL)
+	config.Retry = fastRetryPolicy()
+	config.Retry.MaxRetries = 2
+
+	err := Request[any]{Method: DELETE, Path: "channels/01G11DTVYAJQCJJ9VZMA6GRND3"}.NoContent(config)
+
+	if !errors.Is(err, ErrRetriesExceeded) {
+		t.Fatalf("expected ErrRetriesExceeded, got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRatelimitsDoNotCountAsRetries(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1, 2, 3:
+			w.Header().Set("X-RateLimit-Bucket", "users")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"retry_after":1}`))
+		case 4:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	config := testConfig(srv.URL)
+	config.Retry = fastRetryPolicy()
+
+	// Three ratelimits in a row must not use up the 3 retries of the 503
+	_, err := Request[map[string]any]{Method: GET, Path: "users/@me"}.With(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 5 {
+		t.Fatalf("expected 5 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryMaxElapsed(t *testing.T) {
+	var attempts int32
+	srv := failingServer(t, http.StatusBadGateway, 100, &attempts)
+
+	config := testConfig(srv.URL)
+	config.Retry = fastRetryPolicy()
+	config.Retry.MaxRetries = 100
+	config.Retry.BaseDelay = 20 * time.Millisecond
+	config.Retry.MaxElapsed = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := Request[map[string]any]{Method: GET, Path: "users/@me"}.With(config)
+
+	if !errors.Is(err, ErrRetriesExceeded) {
+		t.Fatalf("expected ErrRetriesExceeded, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("retried for %s", elapsed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &RetryPolicy{
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+		Jitter:    0.2,
+	}
+
+	for retry, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 20; i++ {
+			d := p.Backoff(retry)
+
+			if d < want*8/10 || d > want*12/10 {
+				t.Fatalf("Backoff(%d) = %s, want %s ± 20%%", retry, d, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/auth"
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
+	"github.com/infinitybotlist/grevolt/version"
+	"go.uber.org/zap"
+)
+
+func testConfig(url string) *RestConfig {
+	rl := ratelimits.NewRatelimiter()
+	rl.SetLogger(zap.NewNop())
+
+	return &RestConfig{
+		APIUrl:      url + "/",
+		Logger:      zap.NewNop(),
+		Ratelimiter: rl,
+		Retry:       DefaultRetryPolicy(),
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestHTTPClient(t *testing.T) {
+	config := testConfig("https://revolt.example.com/api")
+
+	var seen string
+	config.HTTPClient = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			seen = r.Method + " " + r.URL.String()
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(`{"_id":"01FD58YK5W7QRV5H3D64KTQYX3","username":"test"}`)),
+				Request:    r,
+			}, nil
+		}),
+	}
+
+	res, err := Request[map[string]any]{Method: GET, Path: "users/01FD58YK5W7QRV5H3D64KTQYX3"}.With(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seen != "GET https://revolt.example.com/api/users/01FD58YK5W7QRV5H3D64KTQYX3" {
+		t.Fatalf("request did not go through the custom transport, got %q", seen)
+	}
+
+	if (*res)["username"] != "test" {
+		t.Fatalf("unexpected response %v", *res)
+	}
+}
+
+// A response body recording whether it was closed
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestResponseBodiesClosed(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		call   func(config *RestConfig) error
+	}{
+		{
+			name:   "with",
+			status: http.StatusOK,
+			body:   `{"username":"test"}` + "\n",
+			call: func(config *RestConfig) error {
+				_, err := Request[map[string]any]{Path: "users/@me"}.With(config)
+				return err
+			},
+		},
+		{
+			name:   "no content",
+			status: http.StatusNoContent,
+			call: func(config *RestConfig) error {
+				return Request[map[string]any]{Method: DELETE, Path: "users/@me"}.NoContent(config)
+			},
+		},
+		{
+			name:   "error",
+			status: http.StatusNotFound,
+			body:   `{"type":"NotFound"}`,
+			call: func(config *RestConfig) error {
+				_, err := Request[map[string]any]{Path: "users/@me"}.With(config)
+				return err
+			},
+		},
+		{
+			name:   "invalid ratelimit headers",
+			status: http.StatusOK,
+			header: http.Header{"X-Ratelimit-Remaining": {"abc"}},
+			body:   `{}`,
+			call: func(config *RestConfig) error {
+				_, err := Request[map[string]any]{Path: "users/@me"}.With(config)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig("https://revolt.example.com/api")
+
+			var body *trackedBody
+			config.HTTPClient = &http.Client{
+				Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					body = &trackedBody{Reader: strings.NewReader(tt.body)}
+
+					header := tt.header
+					if header == nil {
+						header = http.Header{}
+					}
+
+					return &http.Response{StatusCode: tt.status, Header: header, Body: body, Request: r}, nil
+				}),
+			}
+
+			tt.call(config)
+
+			if body == nil || !body.closed {
+				t.Fatal("response body was not closed")
+			}
+
+			// The body must be read to the end for the connection to be reused
+			if n, _ := body.Read(make([]byte, 1)); n != 0 {
+				t.Fatal("response body was not drained")
+			}
+		})
+	}
+}
+
+func TestPrepareHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   *auth.Token
+		headers map[string]string
+		want    map[string]string
+		cookie  string
+	}{
+		{
+			name:  "bot",
+			token: &auth.Token{Bot: true, Token: "bot-token"},
+			want: map[string]string{
+				"X-Bot-Token":     "bot-token",
+				"X-Session-Token": "",
+				"User-Agent":      "grevolt/" + version.Version,
+				"X-Default":       "default",
+			},
+		},
+		{
+			name:  "session",
+			token: &auth.Token{Token: "session-token"},
+			want: map[string]string{
+				"X-Bot-Token":     "",
+				"X-Session-Token": "session-token",
+			},
+		},
+		{
+			name: "cf clearance",
+			token: &auth.Token{
+				Bot:   true,
+				Token: "bot-token",
+				CfClearance: &auth.CfClearance{
+					UserAgent:   "Mozilla/5.0",
+					CookieValue: "clearance",
+				},
+			},
+			want: map[string]string{
+				"X-Bot-Token": "bot-token",
+				"User-Agent":  "Mozilla/5.0",
+			},
+			cookie: "clearance",
+		},
+		{
+			name:    "request headers take precedence",
+			token:   &auth.Token{Bot: true, Token: "bot-token"},
+			headers: map[string]string{"x-default": "overridden", "idempotency-key": "key"},
+			want: map[string]string{
+				"X-Default":       "overridden",
+				"Idempotency-Key": "key",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen *http.Request
+			config := testConfig("https://revolt.example.com/api")
+			config.SessionToken = tt.token
+			config.DefaultHeaders = map[string]string{"x-default": "default"}
+			config.HTTPClient = &http.Client{
+				Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					seen = r
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{},
+						Body:       io.NopCloser(strings.NewReader("")),
+						Request:    r,
+					}, nil
+				}),
+			}
+
+			// Every request type must be prepared the same way
+			requests := map[string]func() error{
+				"With": func() error {
+					_, err := Request[Bytes]{Method: GET, Path: "users/@me", Headers: tt.headers}.With(config)
+					return err
+				},
+				"NoContent": func() error {
+					return Request[any]{Method: DELETE, Path: "users/@me", Headers: tt.headers}.NoContent(config)
+				},
+			}
+
+			for name, do := range requests {
+				seen = nil
+
+				if err := do(); err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+
+				for k, v := range tt.want {
+					if got := seen.Header.Get(k); got != v {
+						t.Errorf("%s: header %s = %q, want %q", name, k, got, v)
+					}
+				}
+
+				if len(seen.Header.Values("User-Agent")) != 1 {
+					t.Errorf("%s: expected a single user agent, got %v", name, seen.Header.Values("User-Agent"))
+				}
+
+				cookie, err := seen.Cookie("cf_clearance")
+
+				if tt.cookie == "" && err == nil {
+					t.Errorf("%s: unexpected cf_clearance cookie", name)
+				} else if tt.cookie != "" && (err != nil || cookie.Value != tt.cookie) {
+					t.Errorf("%s: expected cf_clearance cookie %q, got %v", name, tt.cookie, cookie)
+				}
+			}
+		})
+	}
+}
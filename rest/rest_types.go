@@ -1,15 +1,12 @@
 package rest
 
 import (
-	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/infinitybotlist/grevolt/auth"
 	"github.com/infinitybotlist/grevolt/cache/state"
 	"github.com/infinitybotlist/grevolt/rest/ratelimits"
-	"github.com/infinitybotlist/grevolt/types"
-	"github.com/sethgrid/pester"
 	"go.uber.org/zap"
 )
 
@@ -34,22 +31,36 @@ type RestConfig struct {
 	// Session token for requests
 	SessionToken *auth.Token
 
-	// Ratelimiter
-	Ratelimiter *ratelimits.RateLimiter
+	// Headers added to every request, headers set on a request take precedence
+	DefaultHeaders map[string]string
 
-	// Max tries for requests
-	MaxRestRetries int
+	// Ratelimiter, defaults to an in-memory ratelimiter
+	//
+	// See ratelimits.RateLimiter for using a different backend
+	Ratelimiter ratelimits.RateLimiter
 
-	// On ratelimit function
-	OnRatelimit func(*types.RateLimit)
+	// Which failed requests are retried, nil to never retry
+	Retry *RetryPolicy
 
-	// Whether or not to retry on ratelimit
-	RetryOnRatelimit bool
+	// Called when a request is ratelimited or has to wait for its ratelimit bucket
+	OnRatelimit func(*RatelimitEvent)
 
-	// Pester client
-	Pester *pester.Client
+	// Counters of ratelimit events per route, nil to disable
+	RatelimitStats *RatelimitStats
+
+	// HTTP client used to send every request, defaults to a http.Client using Timeout
+	//
+	// Set this to use a proxy, custom connection pool sizes, custom TLS roots for a
+	// self-hosted instance or a custom http.RoundTripper (such as in tests)
+	HTTPClient *http.Client
+
+	// Interceptors wrapping every HTTP attempt, see Interceptor
+	Interceptors []Interceptor
 
 	// Functions to run upon successful marshal
+	//
+	// These also run after successful requests without a response body (see
+	// Request.NoContent) with v set to nil
 	OnMarshal []func(r *RequestData, v any) error
 
 	// Shared state for rest requests
@@ -57,19 +68,25 @@ type RestConfig struct {
 
 	// Disable rest caching
 	DisableRestCaching bool
+
+	// Default ratelimit priority of requests, see RestClient.WithPriority to
+	// make requests with a different priority
+	Priority ratelimits.Priority
+
+	// Default maximum time a request may wait for its ratelimit bucket, 0 means no limit
+	//
+	// Requests exceeding this fail with a *ratelimits.QueueTimeoutError
+	MaxQueueWait time.Duration
 }
 
 // DefaultRestConfig return the default configuration for the client with the given state
 func DefaultRestConfig(state *state.State) RestConfig {
 	return RestConfig{
-		APIUrl:      RevoltAPIStaging,
-		Timeout:     10 * time.Second,
-		Ratelimiter: ratelimits.NewRatelimiter(),
-		OnRatelimit: func(r *types.RateLimit) {
-			fmt.Println("Ratelimited:", r)
-		},
-		RetryOnRatelimit: true,
-		Pester:           pester.New(),
+		APIUrl:         RevoltAPIStaging,
+		Timeout:        10 * time.Second,
+		Ratelimiter:    ratelimits.NewRatelimiter(),
+		RatelimitStats: NewRatelimitStats(),
+		Retry:          DefaultRetryPolicy(),
 		OnMarshal: []func(r *RequestData, v any) error{
 			Cacher,
 		},
@@ -100,11 +117,27 @@ type Request[T any] struct {
 	// Initial response, if any
 	InitialResp *T
 
+	// Ratelimit priority of this request, defaults to the configs Priority
+	Priority ratelimits.Priority
+
+	// Maximum time this request may wait for its ratelimit bucket, defaults to the configs MaxQueueWait
+	MaxQueueWait time.Duration
+
+	// Requests of the same priority waiting for a bucket are let through round-robin
+	// between fairness keys, defaults to the first ID in the path (usually the channel or server)
+	FairnessKey string
+
 	// Sequence number for this request, internal
 	sequence int
 
+	// Number of retries of this request due to failures, internal
+	failures int
+
+	// Time of the first attempt of this request, internal
+	started time.Time
+
 	// Ratelimit bucket, internal
-	bucket *ratelimits.Bucket
+	bucket ratelimits.BucketLock
 }
 
 // Request data from API, but not generic so can be used in OnMarshal and other functions
@@ -122,12 +155,3 @@ type RequestData struct {
 type Bytes struct {
 	Raw []byte
 }
-
-// Note that a RestError satisfies the error interface
-type RestError struct {
-	types.APIError
-}
-
-func (r RestError) Error() string {
-	return fmt.Sprintln("API Error:", r.APIError.Type(), "", r.APIError)
-}
@@ -0,0 +1,236 @@
+package restcli
+
+import (
+	"time"
+
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/infinitybotlist/grevolt/types/timestamp"
+)
+
+// Maximum number of messages revolt returns per page
+const maxHistoryPageSize = 100
+
+// Direction to walk message history in
+type HistoryDirection int
+
+const (
+	// Walk from the newest message to the oldest, default
+	HistoryBackward HistoryDirection = iota
+
+	// Walk from the oldest message to the newest
+	HistoryForward
+)
+
+// Options for walking the message history of a channel
+type HistoryOptions struct {
+	// Direction to walk history in
+	Direction HistoryDirection
+
+	// Only messages before this message ID are returned
+	Before string
+
+	// Only messages after this message ID are returned
+	After string
+
+	// Stop once messages are older than this (when walking backward) or newer
+	// than this (when walking forward), the time of a message is taken from its ID
+	Until time.Time
+
+	// Maximum number of messages to return, 0 means no limit
+	Limit int
+
+	// Number of messages to fetch per request, defaults to (and can be at most) 100
+	PageSize uint64
+
+	// Whether to fetch the users and members of messages
+	//
+	// These are added to the shared state and can be accessed using MessageIterator.User and
+	// MessageIterator.Member while iterating
+	IncludeUsers bool
+}
+
+// MessageIterator walks the message history of a channel page by page
+//
+//	it := cli.Rest.MessageHistory(channelId, restcli.HistoryOptions{})
+//	for it.Next() {
+//		msg := it.Message()
+//		// ...
+//	}
+//
+//	if err := it.Err(); err != nil {
+//		// ...
+//	}
+type MessageIterator struct {
+	c       *RestClient
+	channel string
+	opts    HistoryOptions
+
+	// Cursor of the next page
+	cursor string
+
+	page    []*types.Message
+	current *types.Message
+	count   int
+	done    bool
+	err     error
+
+	users   map[string]*types.User
+	members map[string]*types.Member
+}
+
+// MessageHistory returns an iterator over the message history of a channel
+//
+// Requests made by the iterator go through the ratelimiter like any other request,
+// use WithPriority to walk history with a lower priority
+func (c *RestClient) MessageHistory(channel string, opts HistoryOptions) *MessageIterator {
+	if opts.PageSize == 0 || opts.PageSize > maxHistoryPageSize {
+		opts.PageSize = maxHistoryPageSize
+	}
+
+	if !opts.Until.IsZero() {
+		// Message IDs only have millisecond precision
+		opts.Until = opts.Until.Truncate(time.Millisecond)
+
+		// Let the server stop at the bound as well, the bounds are exclusive
+		switch opts.Direction {
+		case HistoryBackward:
+			if bound := timestamp.ToULID(opts.Until.Add(-time.Millisecond)); opts.After < bound {
+				opts.After = bound
+			}
+		case HistoryForward:
+			if bound := timestamp.ToULID(opts.Until.Add(time.Millisecond)); opts.Before == "" || opts.Before > bound {
+				opts.Before = bound
+			}
+		}
+	}
+
+	it := &MessageIterator{
+		c:       c,
+		channel: channel,
+		opts:    opts,
+		users:   make(map[string]*types.User),
+		members: make(map[string]*types.Member),
+	}
+
+	if opts.Direction == HistoryForward {
+		it.cursor = opts.After
+	} else {
+		it.cursor = opts.Before
+	}
+
+	return it
+}
+
+// Next advances to the next message, returning false once there are no more
+// messages or an error occurs (see Err)
+func (it *MessageIterator) Next() bool {
+	if it.err != nil || (it.opts.Limit > 0 && it.count >= it.opts.Limit) {
+		return false
+	}
+
+	for len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+
+		if err := it.fetch(); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	msg := it.page[0]
+	it.page = it.page[1:]
+
+	if !it.opts.Until.IsZero() {
+		t, err := timestamp.FromULID(msg.Id)
+
+		if err == nil && ((it.opts.Direction == HistoryBackward && t.Before(it.opts.Until)) || (it.opts.Direction == HistoryForward && t.After(it.opts.Until))) {
+			it.done = true
+			it.page = nil
+			return false
+		}
+	}
+
+	it.current = msg
+	it.count++
+
+	return true
+}
+
+// Fetches the next page
+func (it *MessageIterator) fetch() error {
+	q := &types.MessageQuery{
+		Limit:        it.opts.PageSize,
+		IncludeUsers: it.opts.IncludeUsers,
+	}
+
+	if it.opts.Direction == HistoryForward {
+		q.Sort = types.OLDEST_MessageSort
+		q.After = it.cursor
+		q.Before = it.opts.Before
+	} else {
+		q.Sort = types.LATEST_MessageSort
+		q.Before = it.cursor
+		q.After = it.opts.After
+	}
+
+	res, err := it.c.FetchMessages(it.channel, q)
+
+	if err != nil {
+		return err
+	}
+
+	if uint64(len(res.Messages)) < it.opts.PageSize {
+		it.done = true
+	}
+
+	if len(res.Messages) > 0 {
+		it.cursor = res.Messages[len(res.Messages)-1].Id
+	}
+
+	it.page = res.Messages
+
+	for _, u := range res.Users {
+		it.users[u.Id] = u
+	}
+
+	for _, m := range res.Members {
+		if m.Id != nil {
+			it.members[m.Id.User] = m
+		}
+	}
+
+	return nil
+}
+
+// Message returns the current message
+func (it *MessageIterator) Message() *types.Message {
+	return it.current
+}
+
+// Err returns the error that stopped the iterator, if any
+func (it *MessageIterator) Err() error {
+	return it.err
+}
+
+// User returns a user included with the messages seen so far, IncludeUsers must be set
+func (it *MessageIterator) User(id string) *types.User {
+	return it.users[id]
+}
+
+// Member returns a member included with the messages seen so far, IncludeUsers must be set
+func (it *MessageIterator) Member(userId string) *types.Member {
+	return it.members[userId]
+}
+
+// All collects all remaining messages
+func (it *MessageIterator) All() ([]*types.Message, error) {
+	var msgs []*types.Message
+
+	for it.Next() {
+		msgs = append(msgs, it.Message())
+	}
+
+	return msgs, it.Err()
+}
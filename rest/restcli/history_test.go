@@ -0,0 +1,220 @@
+package restcli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/cache/state"
+	"github.com/infinitybotlist/grevolt/cache/store/basicstore"
+	"github.com/infinitybotlist/grevolt/rest"
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/infinitybotlist/grevolt/types/timestamp"
+	"go.uber.org/zap"
+)
+
+const testChannel = "01G11DTVYAJQCJJ9VZMA6GRND3"
+
+var historyStart = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// Starts a fake API serving count messages, one per second from historyStart
+func historyServer(t *testing.T, count int, requests *int) *RestClient {
+	t.Helper()
+
+	var msgs []*types.Message
+	for i := 0; i < count; i++ {
+		msgs = append(msgs, &types.Message{
+			Id:      timestamp.ToULID(historyStart.Add(time.Duration(i) * time.Second)),
+			Channel: testChannel,
+			Author:  "user" + strconv.Itoa(i%3),
+			Content: strconv.Itoa(i),
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+
+		var page []*types.Message
+		for _, m := range msgs {
+			if (q.Get("before") == "" || m.Id < q.Get("before")) && (q.Get("after") == "" || m.Id > q.Get("after")) {
+				page = append(page, m)
+			}
+		}
+
+		if q.Get("sort") != string(types.OLDEST_MessageSort) {
+			sort.Slice(page, func(i, j int) bool { return page[i].Id > page[j].Id })
+		}
+
+		if len(page) > limit {
+			page = page[:limit]
+		}
+
+		if q.Get("include_users") != "true" {
+			json.NewEncoder(w).Encode(page)
+			return
+		}
+
+		res := map[string]any{"messages": page}
+
+		seen := map[string]bool{}
+		var users []*types.User
+		var members []*types.Member
+		for _, m := range page {
+			if !seen[m.Author] {
+				seen[m.Author] = true
+				users = append(users, &types.User{Id: m.Author, Username: m.Author})
+				members = append(members, &types.Member{Id: &types.MemberId{Server: "server", User: m.Author}})
+			}
+		}
+
+		res["users"] = users
+		res["members"] = members
+
+		json.NewEncoder(w).Encode(res)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return testClient(srv.URL)
+}
+
+// Returns a client using the given fake API
+func testClient(url string) *RestClient {
+	s := &state.State{
+		Users:   &basicstore.BasicStore[types.User]{},
+		Members: &basicstore.BasicStore[types.Member]{},
+	}
+
+	c := &RestClient{Config: rest.DefaultRestConfig(s)}
+	c.Config.APIUrl = url + "/"
+	c.Config.Logger = zap.NewNop()
+	c.Config.Ratelimiter.SetLogger(zap.NewNop())
+	c.Config.OnMarshal = nil
+
+	return c
+}
+
+func TestHistoryBackward(t *testing.T) {
+	var requests int
+	c := historyServer(t, 250, &requests)
+
+	msgs, err := c.MessageHistory(testChannel, HistoryOptions{}).All()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 250 {
+		t.Fatalf("expected 250 messages, got %d", len(msgs))
+	}
+
+	for i, m := range msgs {
+		if m.Content != strconv.Itoa(249-i) {
+			t.Fatalf("message %d out of order: %s", i, m.Content)
+		}
+	}
+
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestHistoryForwardBounds(t *testing.T) {
+	var requests int
+	c := historyServer(t, 250, &requests)
+
+	it := c.MessageHistory(testChannel, HistoryOptions{
+		Direction: HistoryForward,
+		After:     timestamp.ToULID(historyStart.Add(9 * time.Second)),
+		Until:     historyStart.Add(59 * time.Second),
+		PageSize:  20,
+	})
+
+	msgs, err := it.All()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 50 || msgs[0].Content != "10" || msgs[49].Content != "59" {
+		t.Fatalf("expected messages 10-59, got %d messages", len(msgs))
+	}
+}
+
+func TestHistoryUntilAndLimit(t *testing.T) {
+	var requests int
+	c := historyServer(t, 250, &requests)
+
+	msgs, err := c.MessageHistory(testChannel, HistoryOptions{
+		Until: historyStart.Add(100 * time.Second),
+	}).All()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 150 || msgs[149].Content != "100" {
+		t.Fatalf("expected messages 249-100, got %d messages", len(msgs))
+	}
+
+	msgs, err = c.MessageHistory(testChannel, HistoryOptions{Limit: 5}).All()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 5 {
+		t.Fatalf("expected 5 messages, got %d", len(msgs))
+	}
+}
+
+func TestHistoryIncludeUsers(t *testing.T) {
+	var requests int
+	c := historyServer(t, 10, &requests)
+
+	// Users and members are cached by rest.Cacher like any other response
+	c.Config.OnMarshal = []func(r *rest.RequestData, v any) error{rest.Cacher}
+
+	it := c.MessageHistory(testChannel, HistoryOptions{IncludeUsers: true})
+
+	for it.Next() {
+		if it.User(it.Message().Author) == nil || it.Member(it.Message().Author) == nil {
+			t.Fatalf("author of message %s was not included", it.Message().Id)
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "user was not cached", func() bool {
+		_, err := c.Config.SharedState.GetUser("user1")
+		return err == nil
+	})
+
+	eventually(t, "member was not cached", func() bool {
+		_, err := c.Config.SharedState.GetMember("server", "user2")
+		return err == nil
+	})
+}
+
+// Waits for cond to become true, as responses are cached in the background
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,74 @@
+package restcli
+
+import (
+	"errors"
+
+	"github.com/infinitybotlist/grevolt/cache/store"
+	"github.com/infinitybotlist/grevolt/rest"
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+// FetchAllMembers fetches all members of a server along with their users, both are
+// added to the shared state before returning
+//
+// If excludeOffline is set, only online members are fetched. Otherwise, the fetch is
+// treated as complete and cached members of the server that are no longer members are
+// removed from the state. Use State.GetServerMembers to get the members of the server
+// later on without another request.
+//
+// <target is the server id>
+func (c *RestClient) FetchAllMembers(target string, excludeOffline bool) (*types.MemberQueryResponse, error) {
+	path := "servers/" + target + "/members"
+
+	if excludeOffline {
+		path += "?exclude_offline=true"
+	}
+
+	res, err := rest.Request[types.MemberQueryResponse]{Path: path}.With(&c.Config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := c.Config.SharedState
+
+	if s == nil || c.Config.DisableRestCaching {
+		return res, nil
+	}
+
+	// rest.Cacher caches in the background, callers expect the members to be cached
+	// once this returns
+	err = rest.CacheImpl(&rest.RequestData{Method: rest.GET, Path: path, Config: &c.Config}, res)
+
+	if err != nil || excludeOffline {
+		return res, err
+	}
+
+	current := make(map[string]bool, len(res.Members))
+	for _, m := range res.Members {
+		if m.Id != nil {
+			current[m.Id.User] = true
+		}
+	}
+
+	cached, err := s.GetServerMembers(target)
+
+	if errors.Is(err, store.ErrUnsupported) {
+		// The store can't list members, there is nothing to clean up
+		return res, nil
+	} else if err != nil {
+		return res, err
+	}
+
+	for _, m := range cached {
+		if m.Id == nil || current[m.Id.User] {
+			continue
+		}
+
+		if err := s.DeleteMember(target, m.Id.User); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,96 @@
+package restcli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/infinitybotlist/grevolt/types"
+)
+
+const testServer = "01G11DTVYAJNCD2JH2Q1TKKHAR"
+
+func TestFetchAllMembers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/servers/"+testServer+"/members" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		res := types.MemberQueryResponse{
+			Members: []types.Member{
+				{Id: &types.MemberId{Server: testServer, User: "online"}},
+			},
+			Users: []types.User{
+				{Id: "online", Username: "online"},
+			},
+		}
+
+		if r.URL.Query().Get("exclude_offline") != "true" {
+			res.Members = append(res.Members, types.Member{Id: &types.MemberId{Server: testServer, User: "offline"}})
+			res.Users = append(res.Users, types.User{Id: "offline", Username: "offline"})
+		}
+
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+	s := c.Config.SharedState
+
+	// A member that has since left the server and a member of another server
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: testServer, User: "left"}})
+	s.AddMember(&types.Member{Id: &types.MemberId{Server: "other", User: "online"}})
+
+	res, err := c.FetchAllMembers(testServer, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Members) != 1 {
+		t.Fatalf("expected only online members, got %d", len(res.Members))
+	}
+
+	if _, err := s.GetMember(testServer, "online"); err != nil {
+		t.Fatal("online member was not cached")
+	}
+
+	// Fetching only online members must not remove offline members
+	if _, err := s.GetMember(testServer, "left"); err != nil {
+		t.Fatal("member was removed by a partial fetch")
+	}
+
+	if _, err := c.FetchAllMembers(testServer, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetMember(testServer, "left"); err == nil {
+		t.Fatal("member that left was not removed by a full fetch")
+	}
+
+	// Members and users are cached before returning
+	members, err := s.GetServerMembers(testServer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, m := range members {
+		got[m.Id.User] = true
+	}
+
+	if len(got) != 2 || !got["online"] || !got["offline"] {
+		t.Fatalf("members were not cached: %v", got)
+	}
+
+	if u, err := s.GetUser("offline"); err != nil || u.Username != "offline" {
+		t.Fatal("user was not cached")
+	}
+
+	if _, err := s.GetMember("other", "online"); err != nil {
+		t.Fatal("member of another server was removed")
+	}
+}
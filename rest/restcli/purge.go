@@ -0,0 +1,192 @@
+package restcli
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/rest"
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/infinitybotlist/grevolt/types/timestamp"
+)
+
+// Maximum number of messages that can be deleted in one bulk delete
+const maxBulkDelete = 100
+
+// Messages older than this can't be bulk deleted
+const maxBulkDeleteAge = 7 * 24 * time.Hour
+
+// Leeway for messages close to the bulk delete age limit, in case of clock skew
+const bulkDeleteAgeLeeway = 5 * time.Minute
+
+// A filter deciding whether a message should be purged, author is nil if unknown
+type PurgeFilter func(m *types.Message, author *types.User) bool
+
+// PurgeByAuthor matches messages sent by any of the given users
+func PurgeByAuthor(ids ...string) PurgeFilter {
+	return func(m *types.Message, author *types.User) bool {
+		for _, id := range ids {
+			if m.Author == id {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// PurgeContaining matches messages containing the given text, ignoring case
+func PurgeContaining(text string) PurgeFilter {
+	text = strings.ToLower(text)
+
+	return func(m *types.Message, author *types.User) bool {
+		return strings.Contains(strings.ToLower(m.Content), text)
+	}
+}
+
+// PurgeWithAttachments matches messages with attachments
+func PurgeWithAttachments() PurgeFilter {
+	return func(m *types.Message, author *types.User) bool {
+		return len(m.Attachments) > 0
+	}
+}
+
+// PurgeBots matches messages sent by bots or webhooks
+func PurgeBots() PurgeFilter {
+	return func(m *types.Message, author *types.User) bool {
+		return m.Webhook != nil || (author != nil && author.Bot != nil)
+	}
+}
+
+// Options for purging messages
+type PurgeOptions struct {
+	// Maximum number of messages to delete, 0 means no limit
+	Limit int
+
+	// Only messages before this message ID are purged, defaults to the newest message
+	Before string
+
+	// Only messages sent after this time are purged, the zero time means no limit
+	Since time.Time
+
+	// Only messages matching all filters are purged
+	Filters []PurgeFilter
+
+	// Called after every deletion with the progress so far
+	OnProgress func(p *PurgeProgress)
+}
+
+// Progress of a purge
+type PurgeProgress struct {
+	// Number of messages looked at
+	Scanned int
+
+	// Number of messages matching the filters
+	Matched int
+
+	// Number of messages deleted
+	Deleted int
+}
+
+// Purge deletes messages in a channel matching the given filters, newest message first
+//
+// Messages are bulk deleted in batches, messages too old to be bulk deleted are
+// deleted one by one. This requires the ManageMessages permission.
+//
+// The purge runs in the background priority so that it does not delay other requests
+// made by the rest client, such as replies to users.
+//
+// The progress made so far is returned even if an error occurs
+func (c *RestClient) Purge(channel string, opts PurgeOptions) (*PurgeProgress, error) {
+	c = c.WithPriority(ratelimits.PriorityBackground)
+
+	p := &PurgeProgress{}
+
+	it := c.MessageHistory(channel, HistoryOptions{
+		Before:       opts.Before,
+		Until:        opts.Since,
+		IncludeUsers: true,
+	})
+
+	var batch []string
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := c.BulkDeleteMessages(channel, &types.MessageIds{Ids: batch})
+
+		if err != nil {
+			return err
+		}
+
+		p.Deleted += len(batch)
+		batch = nil
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(p)
+		}
+
+		return nil
+	}
+
+	bulkCutoff := time.Now().Add(-maxBulkDeleteAge + bulkDeleteAgeLeeway)
+
+	for (opts.Limit <= 0 || p.Matched < opts.Limit) && it.Next() {
+		m := it.Message()
+		p.Scanned++
+
+		if !purgeMatches(opts.Filters, m, it.User(m.Author)) {
+			continue
+		}
+
+		p.Matched++
+
+		if t, err := timestamp.FromULID(m.Id); err == nil && t.After(bulkCutoff) {
+			batch = append(batch, m.Id)
+
+			if len(batch) >= maxBulkDelete {
+				if err := flush(); err != nil {
+					return p, err
+				}
+			}
+
+			continue
+		}
+
+		// Too old to bulk delete
+		err := c.DeleteMessage(channel, m.Id)
+
+		if errors.Is(err, rest.ErrNotFound) || errors.Is(err, rest.ErrUnknownMessage) {
+			// Already deleted by someone else
+			continue
+		} else if err != nil {
+			return p, err
+		}
+
+		p.Deleted++
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(p)
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return p, err
+	}
+
+	return p, flush()
+}
+
+// Returns whether a message matches all filters
+func purgeMatches(filters []PurgeFilter, m *types.Message, author *types.User) bool {
+	for _, f := range filters {
+		if !f(m, author) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,270 @@
+package restcli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/infinitybotlist/grevolt/rest"
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
+	"github.com/infinitybotlist/grevolt/types"
+	"github.com/infinitybotlist/grevolt/types/timestamp"
+)
+
+// A fake channel supporting fetching and deleting messages
+type fakeChannel struct {
+	mu      sync.Mutex
+	msgs    map[string]*types.Message
+	bulk    [][]string
+	singles []string
+
+	// Messages that are listed but were already deleted
+	gone map[string]bool
+}
+
+func (f *fakeChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := "/channels/" + testChannel + "/messages"
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == prefix:
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+
+		var page []*types.Message
+		for _, m := range f.msgs {
+			if (q.Get("before") == "" || m.Id < q.Get("before")) && (q.Get("after") == "" || m.Id > q.Get("after")) {
+				page = append(page, m)
+			}
+		}
+
+		sort.Slice(page, func(i, j int) bool { return page[i].Id > page[j].Id })
+
+		if len(page) > limit {
+			page = page[:limit]
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"messages": page,
+			"users": []*types.User{
+				{Id: "bot", Username: "bot", Bot: &types.BotInformation{Owner: "human"}},
+				{Id: "human", Username: "human"},
+			},
+		})
+	case r.Method == http.MethodDelete && r.URL.Path == prefix+"/bulk":
+		var ids types.MessageIds
+		json.NewDecoder(r.Body).Decode(&ids)
+
+		if len(ids.Ids) > maxBulkDelete {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for _, id := range ids.Ids {
+			t, _ := timestamp.FromULID(id)
+
+			if time.Since(t) > maxBulkDeleteAge {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			delete(f.msgs, id)
+		}
+
+		f.bulk = append(f.bulk, ids.Ids)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, prefix+"/"):
+		id := strings.TrimPrefix(r.URL.Path, prefix+"/")
+
+		if f.gone[id] {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type":"NotFound"}`))
+			return
+		}
+
+		delete(f.msgs, id)
+		f.singles = append(f.singles, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	f := &fakeChannel{msgs: map[string]*types.Message{}}
+
+	// 250 recent messages and 10 messages too old to bulk delete
+	now := time.Now()
+	for i := 0; i < 260; i++ {
+		sent := now.Add(-time.Duration(i) * time.Minute)
+
+		if i >= 250 {
+			sent = now.Add(-8 * 24 * time.Hour).Add(-time.Duration(i) * time.Minute)
+		}
+
+		m := &types.Message{
+			Id:      timestamp.ToULID(sent),
+			Channel: testChannel,
+			Author:  []string{"bot", "human"}[i%2],
+			Content: "message " + strconv.Itoa(i),
+		}
+
+		if i%4 == 0 {
+			m.Attachments = []*types.File{{Id: "file"}}
+		}
+
+		f.msgs[m.Id] = m
+	}
+
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+
+	var progress []int
+	p, err := c.Purge(testChannel, PurgeOptions{
+		Filters: []PurgeFilter{PurgeBots()},
+		OnProgress: func(p *PurgeProgress) {
+			progress = append(progress, p.Deleted)
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Scanned != 260 || p.Matched != 130 || p.Deleted != 130 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+
+	if len(f.bulk) != 2 || len(f.bulk[0]) != 100 || len(f.bulk[1]) != 25 {
+		t.Fatalf("unexpected bulk deletes %v", f.bulk)
+	}
+
+	if len(f.singles) != 5 {
+		t.Fatalf("expected 5 single deletes, got %d", len(f.singles))
+	}
+
+	if len(progress) == 0 || progress[len(progress)-1] != 130 {
+		t.Fatalf("unexpected progress reports %v", progress)
+	}
+
+	for _, m := range f.msgs {
+		if m.Author == "bot" {
+			t.Fatalf("message %s by a bot was not purged", m.Id)
+		}
+	}
+}
+
+func TestPurgeFiltersAndLimit(t *testing.T) {
+	f := &fakeChannel{msgs: map[string]*types.Message{}}
+
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		m := &types.Message{
+			Id:      timestamp.ToULID(now.Add(-time.Duration(i) * time.Minute)),
+			Channel: testChannel,
+			Author:  "human",
+			Content: "Message " + strconv.Itoa(i),
+		}
+
+		if i%2 == 0 {
+			m.Attachments = []*types.File{{Id: "file"}}
+		}
+
+		f.msgs[m.Id] = m
+	}
+
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+
+	p, err := c.Purge(testChannel, PurgeOptions{
+		Limit:   3,
+		Since:   now.Add(-30 * time.Minute),
+		Filters: []PurgeFilter{PurgeByAuthor("human"), PurgeContaining("message 1"), PurgeWithAttachments()},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Message 10, 12 and 14 (newest first)
+	if p.Deleted != 3 || len(f.bulk) != 1 {
+		t.Fatalf("unexpected purge %+v %v", p, f.bulk)
+	}
+
+	if len(f.msgs) != 47 {
+		t.Fatalf("expected 47 remaining messages, got %d", len(f.msgs))
+	}
+
+	for _, m := range f.msgs {
+		switch m.Content {
+		case "Message 10", "Message 12", "Message 14":
+			t.Fatalf("%s was not purged", m.Content)
+		}
+	}
+}
+
+func TestPurgeAlreadyDeleted(t *testing.T) {
+	f := &fakeChannel{msgs: map[string]*types.Message{}, gone: map[string]bool{}}
+
+	// Too old to bulk delete, so every message is deleted on its own
+	old := time.Now().Add(-8 * 24 * time.Hour)
+	for i := 0; i < 3; i++ {
+		m := &types.Message{
+			Id:      timestamp.ToULID(old.Add(-time.Duration(i) * time.Minute)),
+			Channel: testChannel,
+			Author:  "human",
+		}
+
+		f.msgs[m.Id] = m
+
+		if i == 1 {
+			f.gone[m.Id] = true
+		}
+	}
+
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+
+	var priorities []ratelimits.Priority
+	c.Config.Interceptors = []rest.Interceptor{
+		func(req *rest.InterceptedRequest, next rest.RoundTrip) (*http.Response, error) {
+			priorities = append(priorities, req.Config.Priority)
+			return next(req)
+		},
+	}
+
+	p, err := c.Purge(testChannel, PurgeOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Matched != 3 || p.Deleted != 2 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+
+	// Purges must not delay other requests
+	for _, prio := range priorities {
+		if prio != ratelimits.PriorityBackground {
+			t.Fatalf("purge request sent with priority %d", prio)
+		}
+	}
+
+	if c.Config.Priority != ratelimits.PriorityNormal {
+		t.Fatal("purge changed the priority of the rest client")
+	}
+}
@@ -1,8 +1,11 @@
 package restcli
 
 import (
+	"time"
+
 	"github.com/infinitybotlist/grevolt/cache/state"
 	"github.com/infinitybotlist/grevolt/rest"
+	"github.com/infinitybotlist/grevolt/rest/ratelimits"
 )
 
 type RestClient struct {
@@ -16,6 +19,23 @@ func DefaultRestClient(state *state.State) *RestClient {
 	}
 }
 
+// WithPriority returns a copy of the rest client whose requests use the given ratelimit priority
+//
+// For example, c.WithPriority(ratelimits.PriorityBackground).BulkDeleteMessages(...)
+func (c *RestClient) WithPriority(p ratelimits.Priority) *RestClient {
+	nc := *c
+	nc.Config.Priority = p
+	return &nc
+}
+
+// WithMaxQueueWait returns a copy of the rest client whose requests wait at most d
+// for their ratelimit bucket before failing with a *ratelimits.QueueTimeoutError
+func (c *RestClient) WithMaxQueueWait(d time.Duration) *RestClient {
+	nc := *c
+	nc.Config.MaxQueueWait = d
+	return &nc
+}
+
 // Helper methood for ternary
 func ternary(condition bool, trueVal, falseVal string) string {
 	if condition {
@@ -26,7 +26,7 @@ func (t *Timestamp) UnmarshalMsgpack(b []byte) error {
 
 		err1 := msgpack.Unmarshal(b, &ts)
 
-		if err != nil {
+		if err1 != nil {
 			return errors.New("failed to unmarshal msgpack: " + err.Error() + " and " + err1.Error())
 		}
 
@@ -39,3 +39,8 @@ func (t *Timestamp) UnmarshalMsgpack(b []byte) error {
 
 	return nil
 }
+
+// Encodes the timestamp as a msgpack timestamp, which UnmarshalMsgpack decodes back
+func (t Timestamp) MarshalMsgpack() ([]byte, error) {
+	return msgpack.Marshal(t.Time)
+}
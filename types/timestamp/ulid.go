@@ -0,0 +1,53 @@
+package timestamp
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Crockford's base32 alphabet used by ULIDs
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Length of the timestamp part of a ULID
+const ulidTimeLen = 10
+
+// FromULID returns the time encoded in a ULID (such as a message or channel ID)
+func FromULID(id string) (time.Time, error) {
+	if len(id) != 26 {
+		return time.Time{}, errors.New("invalid ulid length")
+	}
+
+	var ms uint64
+	for _, c := range strings.ToUpper(id[:ulidTimeLen]) {
+		i := strings.IndexRune(ulidAlphabet, c)
+
+		if i < 0 {
+			return time.Time{}, errors.New("invalid ulid character")
+		}
+
+		ms = ms<<5 | uint64(i)
+	}
+
+	return time.UnixMilli(int64(ms)), nil
+}
+
+// ToULID returns the smallest ULID with the given time
+//
+// This can be used as a bound when fetching messages, for example fetching messages
+// after ToULID(t) returns all messages sent at or after t
+func ToULID(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+
+	var b [26]byte
+	for i := ulidTimeLen - 1; i >= 0; i-- {
+		b[i] = ulidAlphabet[ms&31]
+		ms >>= 5
+	}
+
+	for i := ulidTimeLen; i < len(b); i++ {
+		b[i] = '0'
+	}
+
+	return string(b[:])
+}